@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"main.go/events"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrInvalidBookingDates = errors.New("booking end date must be after start date")
+	ErrRoomNotAvailable    = errors.New("room is already booked in this period")
+	ErrReservationNotFound = errors.New("reservation not found")
+)
+
+// RoomAvailability is an aggregate which knows when rooms are booked.
+// It is used by BookRoomHandler and ModifyBookingHandler to reject bookings overlapping with already existing ones.
+//
+// The state is built from past RoomBooked events (see LoadRoomAvailability), but BookRoomHandler is also reserving rooms directly,
+// so two BookRoom commands for the same room handled in a short period won't both succeed
+// before the first RoomBooked event arrives.
+type RoomAvailability struct {
+	// bookings are kept per room id
+	bookings map[string][]roomBooking
+	// reservations maps reservation id to the room id
+	reservations map[string]string
+	// held maps reservation id to the room id of its new booking held by HoldMove
+	held map[string]string
+	lock sync.Mutex
+}
+
+type roomBooking struct {
+	reservationID string
+	startDate     time.Time
+	endDate       time.Time
+	// held is true for the new booking of modified reservation, which was not saved yet (see HoldMove)
+	held bool
+}
+
+// overlaps returns true when the booking collides with the given period.
+// Guest checking out on the same day when another guest checks in is not an overlap.
+func (b roomBooking) overlaps(startDate, endDate time.Time) bool {
+	return startDate.Before(b.endDate) && b.startDate.Before(endDate)
+}
+
+func NewRoomAvailability() *RoomAvailability {
+	return &RoomAvailability{
+		bookings:     map[string][]roomBooking{},
+		reservations: map[string]string{},
+		held:         map[string]string{},
+	}
+}
+
+// Reserve books the room for the given period.
+// It returns ErrRoomNotAvailable when the room is already booked and ErrInvalidBookingDates for an empty period.
+//
+// Reserving the same reservation again is a no-op, so it is safe to call it when the command is redelivered.
+func (r *RoomAvailability) Reserve(reservationID, roomID string, startDate, endDate time.Time) error {
+	if !startDate.Before(endDate) {
+		return ErrInvalidBookingDates
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, booking := range r.bookings[roomID] {
+		if booking.reservationID == reservationID {
+			return nil
+		}
+		if booking.overlaps(startDate, endDate) {
+			return ErrRoomNotAvailable
+		}
+	}
+
+	r.add(reservationID, roomID, startDate, endDate, false)
+
+	return nil
+}
+
+// Move changes room and period of the reservation, for example when the booking is modified.
+// It returns ErrRoomNotAvailable when the new period overlaps with other bookings, the reservation itself is not
+// an overlap, so its stay can be shortened or extended. When it fails, the reservation keeps its room and period.
+//
+// The booking held for the same room and period by HoldMove is not needed anymore, so it's removed.
+func (r *RoomAvailability) Move(reservationID, roomID string, startDate, endDate time.Time) error {
+	if !startDate.Before(endDate) {
+		return ErrInvalidBookingDates
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.checkAvailable(reservationID, roomID, startDate, endDate); err != nil {
+		return err
+	}
+
+	if held, ok := r.find(reservationID, true); ok && r.held[reservationID] == roomID &&
+		held.startDate.Equal(startDate) && held.endDate.Equal(endDate) {
+		r.remove(reservationID, true)
+	}
+
+	r.remove(reservationID, false)
+	r.add(reservationID, roomID, startDate, endDate, false)
+
+	return nil
+}
+
+// HoldMove books the new room and period of the reservation, while it keeps its current booking.
+// When the modified reservation is saved, the move is finished by ConfirmMove, otherwise it's reverted by CancelMove,
+// so the reservation never loses its room.
+//
+// It returns the same errors as Move, a booking held before for the reservation is replaced.
+func (r *RoomAvailability) HoldMove(reservationID, roomID string, startDate, endDate time.Time) error {
+	if !startDate.Before(endDate) {
+		return ErrInvalidBookingDates
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.checkAvailable(reservationID, roomID, startDate, endDate); err != nil {
+		return err
+	}
+
+	r.remove(reservationID, true)
+	r.add(reservationID, roomID, startDate, endDate, true)
+
+	return nil
+}
+
+// ConfirmMove replaces the current booking of the reservation with the booking held by HoldMove.
+// It does nothing when there is no held booking, for example when it was already moved by BookingModified.
+func (r *RoomAvailability) ConfirmMove(reservationID string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	held, ok := r.find(reservationID, true)
+	if !ok {
+		return
+	}
+	roomID := r.held[reservationID]
+
+	r.remove(reservationID, true)
+	r.remove(reservationID, false)
+	r.add(reservationID, roomID, held.startDate, held.endDate, false)
+}
+
+// CancelMove releases the booking held by HoldMove, the reservation keeps its current booking.
+func (r *RoomAvailability) CancelMove(reservationID string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.remove(reservationID, true)
+}
+
+// Release removes the reservation, so the room becomes available again for its period.
+// ErrReservationNotFound is returned when there is nothing to release.
+func (r *RoomAvailability) Release(reservationID string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.remove(reservationID, true)
+	if !r.remove(reservationID, false) {
+		return ErrReservationNotFound
+	}
+
+	return nil
+}
+
+// checkAvailable returns ErrRoomNotAvailable, when the period overlaps with bookings of other reservations.
+func (r *RoomAvailability) checkAvailable(reservationID, roomID string, startDate, endDate time.Time) error {
+	for _, booking := range r.bookings[roomID] {
+		if booking.reservationID != reservationID && booking.overlaps(startDate, endDate) {
+			return ErrRoomNotAvailable
+		}
+	}
+
+	return nil
+}
+
+func (r *RoomAvailability) add(reservationID, roomID string, startDate, endDate time.Time, held bool) {
+	r.bookings[roomID] = append(r.bookings[roomID], roomBooking{
+		reservationID: reservationID,
+		startDate:     startDate,
+		endDate:       endDate,
+		held:          held,
+	})
+
+	if held {
+		r.held[reservationID] = roomID
+	} else {
+		r.reservations[reservationID] = roomID
+	}
+}
+
+// find returns the current or the held booking of the reservation.
+func (r *RoomAvailability) find(reservationID string, held bool) (roomBooking, bool) {
+	roomID, ok := r.roomOf(reservationID, held)
+	if !ok {
+		return roomBooking{}, false
+	}
+
+	for _, booking := range r.bookings[roomID] {
+		if booking.reservationID == reservationID && booking.held == held {
+			return booking, true
+		}
+	}
+
+	return roomBooking{}, false
+}
+
+// remove removes the current or the held booking of the reservation, it returns false when there is no such booking.
+func (r *RoomAvailability) remove(reservationID string, held bool) bool {
+	roomID, ok := r.roomOf(reservationID, held)
+	if !ok {
+		return false
+	}
+
+	bookings := r.bookings[roomID]
+	for i, booking := range bookings {
+		if booking.reservationID == reservationID && booking.held == held {
+			r.bookings[roomID] = append(bookings[:i:i], bookings[i+1:]...)
+			break
+		}
+	}
+
+	if held {
+		delete(r.held, reservationID)
+	} else {
+		delete(r.reservations, reservationID)
+	}
+
+	return true
+}
+
+func (r *RoomAvailability) roomOf(reservationID string, held bool) (string, bool) {
+	if held {
+		roomID, ok := r.held[reservationID]
+		return roomID, ok
+	}
+
+	roomID, ok := r.reservations[reservationID]
+	return roomID, ok
+}
+
+// LoadRoomAvailability creates RoomAvailability with all bookings from reservation streams of the event store.
+func LoadRoomAvailability(
+	ctx context.Context,
+	eventStore EventStore,
+	marshaler cqrs.CommandEventMarshaler,
+) (*RoomAvailability, error) {
+	r := NewRoomAvailability()
+
+	err := replayEvents(ctx, eventStore, marshaler, reservationStreamPrefix, reservationEvents, func(event proto.Message) {
+		switch e := event.(type) {
+		case *events.RoomBooked:
+			_ = r.Reserve(e.ReservationId, e.RoomId, e.StartDate.AsTime(), e.EndDate.AsTime())
+		case *events.BookingModified:
+			_ = r.Move(e.ReservationId, e.RoomId, e.StartDate.AsTime(), e.EndDate.AsTime())
+		case *events.BookingCancelled:
+			_ = r.Release(e.ReservationId)
+		}
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot load room availability")
+	}
+
+	return r, nil
+}
+
+func (r *RoomAvailability) HandlerName() string {
+	return "RoomAvailability"
+}
+
+func (*RoomAvailability) NewEvent() interface{} {
+	return &events.RoomBooked{}
+}
+
+func (r *RoomAvailability) Handle(ctx context.Context, e interface{}) error {
+	event := e.(*events.RoomBooked)
+
+	// RoomBooked emitted before overlapping bookings were rejected may collide with other bookings,
+	// but it already happened, so we can only ignore the error.
+	_ = r.Reserve(event.ReservationId, event.RoomId, event.StartDate.AsTime(), event.EndDate.AsTime())
+
+	return nil
+}
+
+// BookingCancelledHandler makes the room available again when the booking was cancelled.
+func (r *RoomAvailability) BookingCancelledHandler() cqrs.EventHandler {
+	return eventHandler{
+		name:     "RoomAvailabilityOnBookingCancelled",
+		newEvent: func() interface{} { return &events.BookingCancelled{} },
+		handle: func(ctx context.Context, e interface{}) error {
+			event := e.(*events.BookingCancelled)
+
+			// booking may be already released by CancelBookingHandler
+			_ = r.Release(event.ReservationId)
+			return nil
+		},
+	}
+}
+
+// BookingModifiedHandler moves the booking to its new room and period.
+func (r *RoomAvailability) BookingModifiedHandler() cqrs.EventHandler {
+	return eventHandler{
+		name:     "RoomAvailabilityOnBookingModified",
+		newEvent: func() interface{} { return &events.BookingModified{} },
+		handle: func(ctx context.Context, e interface{}) error {
+			event := e.(*events.BookingModified)
+
+			// booking may be already moved by ModifyBookingHandler
+			_ = r.Move(event.ReservationId, event.RoomId, event.StartDate.AsTime(), event.EndDate.AsTime())
+			return nil
+		},
+	}
+}
+
+// bookingRejectionReason maps error returned by RoomAvailability.Reserve or Pricing to a reason sent to the guest.
+func bookingRejectionReason(err error) events.BookingRejectionReason {
+	switch errors.Cause(err) {
+	case ErrRoomNotAvailable:
+		return events.BookingRejectionReason_ROOM_NOT_AVAILABLE
+	case ErrInvalidBookingDates, ErrStayTooLong:
+		return events.BookingRejectionReason_INVALID_DATES
+	case ErrInvalidPromoCode:
+		return events.BookingRejectionReason_INVALID_PROMO_CODE
+	default:
+		return events.BookingRejectionReason_BOOKING_REJECTION_REASON_UNSPECIFIED
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRoomAvailability_Reserve(t *testing.T) {
+	availability := NewRoomAvailability()
+
+	march10 := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+	march12 := time.Date(2027, 3, 12, 0, 0, 0, 0, time.UTC)
+	march15 := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)
+	march17 := time.Date(2027, 3, 17, 0, 0, 0, 0, time.UTC)
+
+	if err := availability.Reserve("1", "101", march10, march15); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := availability.Reserve("2", "101", march12, march17); errors.Cause(err) != ErrRoomNotAvailable {
+		t.Errorf("expected ErrRoomNotAvailable for overlapping booking, got %v", err)
+	}
+	if err := availability.Reserve("2", "101", march10, march17); errors.Cause(err) != ErrRoomNotAvailable {
+		t.Errorf("expected ErrRoomNotAvailable for booking around existing one, got %v", err)
+	}
+	if err := availability.Reserve("2", "102", march10, march15); err != nil {
+		t.Errorf("other room should be available, got %v", err)
+	}
+
+	// guest can check in on the day when the previous guest checks out
+	if err := availability.Reserve("3", "101", march15, march17); err != nil {
+		t.Errorf("room should be available from check-out day, got %v", err)
+	}
+
+	if err := availability.Reserve("1", "101", march10, march15); err != nil {
+		t.Errorf("redelivered reservation should be accepted, got %v", err)
+	}
+
+	if err := availability.Reserve("4", "103", march10, march10); errors.Cause(err) != ErrInvalidBookingDates {
+		t.Errorf("expected ErrInvalidBookingDates for empty period, got %v", err)
+	}
+}
+
+func TestRoomAvailability_Release(t *testing.T) {
+	availability := NewRoomAvailability()
+
+	march10 := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+	march15 := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	if err := availability.Reserve("1", "101", march10, march15); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := availability.Release("1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := availability.Release("1"); errors.Cause(err) != ErrReservationNotFound {
+		t.Errorf("expected ErrReservationNotFound, got %v", err)
+	}
+
+	if err := availability.Reserve("2", "101", march10, march15); err != nil {
+		t.Errorf("released room should be available, got %v", err)
+	}
+}
+
+func TestRoomAvailability_Move(t *testing.T) {
+	availability := NewRoomAvailability()
+
+	march10 := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+	march15 := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)
+	march17 := time.Date(2027, 3, 17, 0, 0, 0, 0, time.UTC)
+	march20 := time.Date(2027, 3, 20, 0, 0, 0, 0, time.UTC)
+	march21 := time.Date(2027, 3, 21, 0, 0, 0, 0, time.UTC)
+
+	if err := availability.Reserve("1", "101", march10, march15); err != nil {
+		t.Fatal(err)
+	}
+	if err := availability.Reserve("2", "101", march20, march21); err != nil {
+		t.Fatal(err)
+	}
+
+	// the reservation doesn't overlap with itself, so the stay can be extended
+	if err := availability.Move("1", "101", march10, march17); err != nil {
+		t.Fatal(err)
+	}
+	if err := availability.Move("1", "101", march10, march21); errors.Cause(err) != ErrRoomNotAvailable {
+		t.Errorf("expected ErrRoomNotAvailable, got %v", err)
+	}
+	if err := availability.Reserve("3", "101", march15, march17); errors.Cause(err) != ErrRoomNotAvailable {
+		t.Errorf("failed move should keep the previous period booked, got %v", err)
+	}
+
+	if err := availability.Move("1", "102", march10, march15); err != nil {
+		t.Fatal(err)
+	}
+	if err := availability.Reserve("3", "101", march10, march17); err != nil {
+		t.Errorf("room should be available after the reservation moved to other room, got %v", err)
+	}
+	if err := availability.Reserve("4", "102", march10, march15); errors.Cause(err) != ErrRoomNotAvailable {
+		t.Errorf("expected ErrRoomNotAvailable in the new room, got %v", err)
+	}
+}
+
+func TestRoomAvailability_HoldMove(t *testing.T) {
+	availability := NewRoomAvailability()
+
+	march10 := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+	march15 := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	if err := availability.Reserve("1", "101", march10, march15); err != nil {
+		t.Fatal(err)
+	}
+	if err := availability.HoldMove("1", "102", march10, march15); err != nil {
+		t.Fatal(err)
+	}
+
+	// both rooms are booked until the move is finished
+	if err := availability.Reserve("2", "101", march10, march15); errors.Cause(err) != ErrRoomNotAvailable {
+		t.Errorf("expected ErrRoomNotAvailable in the current room, got %v", err)
+	}
+	if err := availability.Reserve("2", "102", march10, march15); errors.Cause(err) != ErrRoomNotAvailable {
+		t.Errorf("expected ErrRoomNotAvailable in the held room, got %v", err)
+	}
+
+	availability.ConfirmMove("1")
+
+	if err := availability.Reserve("2", "101", march10, march15); err != nil {
+		t.Errorf("room should be available after the move, got %v", err)
+	}
+	if err := availability.Release("1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := availability.Reserve("3", "102", march10, march15); err != nil {
+		t.Errorf("released reservation should not keep any room, got %v", err)
+	}
+}
+
+func TestRoomAvailability_CancelMove(t *testing.T) {
+	availability := NewRoomAvailability()
+
+	march10 := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+	march15 := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	if err := availability.Reserve("1", "101", march10, march15); err != nil {
+		t.Fatal(err)
+	}
+	if err := availability.HoldMove("1", "102", march10, march15); err != nil {
+		t.Fatal(err)
+	}
+
+	availability.CancelMove("1")
+
+	if err := availability.Reserve("2", "102", march10, march15); err != nil {
+		t.Errorf("held room should be available after the move was cancelled, got %v", err)
+	}
+	if err := availability.Reserve("3", "101", march10, march15); errors.Cause(err) != ErrRoomNotAvailable {
+		t.Errorf("reservation should keep its room after the move was cancelled, got %v", err)
+	}
+
+	// nothing is held anymore, so confirming keeps the current booking
+	availability.ConfirmMove("1")
+	if err := availability.Reserve("3", "101", march10, march15); errors.Cause(err) != ErrRoomNotAvailable {
+		t.Errorf("reservation should keep its room, got %v", err)
+	}
+}
+
+func TestRoomAvailability_HoldMove_movedByEvent(t *testing.T) {
+	availability := NewRoomAvailability()
+
+	march10 := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+	march15 := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	if err := availability.Reserve("1", "101", march10, march15); err != nil {
+		t.Fatal(err)
+	}
+	if err := availability.HoldMove("1", "102", march10, march15); err != nil {
+		t.Fatal(err)
+	}
+
+	// BookingModified may be handled before the move is confirmed
+	if err := availability.Move("1", "102", march10, march15); err != nil {
+		t.Fatal(err)
+	}
+	availability.ConfirmMove("1")
+
+	if err := availability.Reserve("2", "101", march10, march15); err != nil {
+		t.Errorf("room should be available after the move, got %v", err)
+	}
+	if err := availability.Reserve("3", "102", march10, march15); errors.Cause(err) != ErrRoomNotAvailable {
+		t.Errorf("expected ErrRoomNotAvailable in the new room, got %v", err)
+	}
+}
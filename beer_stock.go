@@ -0,0 +1,283 @@
+package main
+
+import (
+	"main.go/events"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+var ErrUnknownBeerType = errors.New("unknown beer type")
+
+// beerStockRecentOrders is the number of served and cancelled orders remembered by BeerStock,
+// redelivered OrderBeer comes shortly after the first delivery, so older orders don't need to be remembered.
+const beerStockRecentOrders = 1000
+
+// BeerStock is an event sourced aggregate with the stock of one beer type in the bar.
+//
+// Order which can't be served from the stock is back-ordered (BeerOutOfStock), instead of failing.
+// Back-orders are served in the order in which they came, when the beer is restocked, unless they are cancelled.
+type BeerStock struct {
+	beerType   string
+	stock      int64
+	backOrders []beerBackOrder
+	// recentOrders are the last served or cancelled orders, the oldest first
+	recentOrders []recentBeerOrder
+
+	// version is version of the event stream from which the stock was loaded
+	version int64
+	// changes are recorded events which were not saved yet
+	changes []proto.Message
+}
+
+type beerBackOrder struct {
+	OrderID       string `json:"order_id"`
+	RoomID        string `json:"room_id"`
+	ReservationID string `json:"reservation_id,omitempty"`
+	Count         int64  `json:"count"`
+}
+
+type recentBeerOrder struct {
+	OrderID string `json:"order_id"`
+	Served  bool   `json:"served"`
+}
+
+// NewBeerStock returns empty stock of the beer, which was never restocked.
+func NewBeerStock(beerType string) *BeerStock {
+	return &BeerStock{beerType: beerType}
+}
+
+func (s *BeerStock) BeerType() string {
+	return s.beerType
+}
+
+func (s *BeerStock) Stock() int64 {
+	return s.stock
+}
+
+// BackOrders returns the number of orders waiting for the beer.
+func (s *BeerStock) BackOrders() int {
+	return len(s.backOrders)
+}
+
+// Order serves beer to the room, or back-orders it when there is not enough beer in the stock
+// (or other orders are already waiting). It returns true when the beer was served.
+// reservationID is empty, when the beer was not ordered by BookingProcess.
+//
+// The order which is already back-ordered, served or cancelled is not recorded again,
+// so the beer is not served twice when the command is redelivered.
+//
+// StockLow is recorded when the stock drops to lowStockThreshold.
+func (s *BeerStock) Order(orderID, roomID, reservationID string, count int64, lowStockThreshold int64) (bool, error) {
+	if count < 1 {
+		return false, errors.Errorf("count must be positive, got %d", count)
+	}
+
+	if served, ok := s.orderServed(orderID); ok {
+		return served, nil
+	}
+
+	if len(s.backOrders) > 0 || s.stock < count {
+		s.record(&events.BeerOutOfStock{
+			OrderId:       orderID,
+			RoomId:        roomID,
+			BeerType:      s.beerType,
+			Count:         count,
+			Available:     s.stock,
+			ReservationId: reservationID,
+		})
+		return false, nil
+	}
+
+	stockBefore := s.stock
+	s.record(&events.BeerOrdered{
+		RoomId:        roomID,
+		Count:         count,
+		BeerType:      s.beerType,
+		OrderId:       orderID,
+		ReservationId: reservationID,
+	})
+	s.checkStockLow(stockBefore, lowStockThreshold)
+
+	return true, nil
+}
+
+// Restock adds beer to the stock and serves back-orders, which can be served now.
+// It returns the served back-orders as BeerOrdered events.
+func (s *BeerStock) Restock(count int64, lowStockThreshold int64) ([]*events.BeerOrdered, error) {
+	if count < 1 {
+		return nil, errors.Errorf("count must be positive, got %d", count)
+	}
+
+	s.record(&events.BeerRestocked{
+		BeerType: s.beerType,
+		Count:    count,
+	})
+
+	return s.serveBackOrders(lowStockThreshold), nil
+}
+
+// CancelBackOrders cancels all back-orders of the reservation, orders which were waiting for them
+// and can be served now are served. It returns the number of cancelled orders and the served orders.
+func (s *BeerStock) CancelBackOrders(reservationID string, lowStockThreshold int64) (int, []*events.BeerOrdered) {
+	if reservationID == "" {
+		return 0, nil
+	}
+
+	var cancelled []beerBackOrder
+	for _, order := range s.backOrders {
+		if order.ReservationID == reservationID {
+			cancelled = append(cancelled, order)
+		}
+	}
+	if len(cancelled) == 0 {
+		return 0, nil
+	}
+
+	for _, order := range cancelled {
+		s.record(&events.BeerOrderCancelled{
+			OrderId:       order.OrderID,
+			RoomId:        order.RoomID,
+			BeerType:      s.beerType,
+			Count:         order.Count,
+			ReservationId: order.ReservationID,
+		})
+	}
+
+	return len(cancelled), s.serveBackOrders(lowStockThreshold)
+}
+
+// serveBackOrders serves back-orders which can be served from the stock.
+func (s *BeerStock) serveBackOrders(lowStockThreshold int64) []*events.BeerOrdered {
+	stockBefore := s.stock
+	var served []*events.BeerOrdered
+
+	// back-orders are served in order, the first one which can't be served waits for the next restock with the rest
+	for len(s.backOrders) > 0 && s.backOrders[0].Count <= s.stock {
+		order := s.backOrders[0]
+
+		event := &events.BeerOrdered{
+			RoomId:        order.RoomID,
+			Count:         order.Count,
+			BeerType:      s.beerType,
+			OrderId:       order.OrderID,
+			ReservationId: order.ReservationID,
+		}
+		s.record(event)
+		served = append(served, event)
+	}
+	s.checkStockLow(stockBefore, lowStockThreshold)
+
+	return served
+}
+
+// orderServed returns true when the order was served, ok is false when the order is unknown.
+func (s *BeerStock) orderServed(orderID string) (served bool, ok bool) {
+	for _, order := range s.backOrders {
+		if order.OrderID == orderID {
+			return false, true
+		}
+	}
+	for _, order := range s.recentOrders {
+		if order.OrderID == orderID {
+			return order.Served, true
+		}
+	}
+
+	return false, false
+}
+
+// checkStockLow records StockLow, when the stock dropped from above the threshold.
+func (s *BeerStock) checkStockLow(stockBefore int64, lowStockThreshold int64) {
+	if stockBefore > lowStockThreshold && s.stock <= lowStockThreshold {
+		s.record(&events.StockLow{
+			BeerType:  s.beerType,
+			Stock:     s.stock,
+			Threshold: lowStockThreshold,
+		})
+	}
+}
+
+func (s *BeerStock) record(event proto.Message) {
+	s.apply(event)
+	s.changes = append(s.changes, event)
+}
+
+// apply changes the state according to the event, it must not check any business rules:
+// the event already happened.
+func (s *BeerStock) apply(event proto.Message) {
+	switch e := event.(type) {
+	case *events.BeerRestocked:
+		s.beerType = e.BeerType
+		s.stock += e.Count
+	case *events.BeerOrdered:
+		s.beerType = e.BeerType
+		s.stock -= e.Count
+		s.removeBackOrder(e.OrderId)
+		s.rememberOrder(e.OrderId, true)
+	case *events.BeerOutOfStock:
+		s.beerType = e.BeerType
+		s.backOrders = append(s.backOrders, beerBackOrder{
+			OrderID:       e.OrderId,
+			RoomID:        e.RoomId,
+			ReservationID: e.ReservationId,
+			Count:         e.Count,
+		})
+	case *events.BeerOrderCancelled:
+		s.beerType = e.BeerType
+		s.removeBackOrder(e.OrderId)
+		s.rememberOrder(e.OrderId, false)
+	}
+}
+
+func (s *BeerStock) rememberOrder(orderID string, served bool) {
+	s.recentOrders = append(s.recentOrders, recentBeerOrder{OrderID: orderID, Served: served})
+	if len(s.recentOrders) > beerStockRecentOrders {
+		s.recentOrders = append([]recentBeerOrder(nil), s.recentOrders[len(s.recentOrders)-beerStockRecentOrders:]...)
+	}
+}
+
+func (s *BeerStock) removeBackOrder(orderID string) {
+	for i, order := range s.backOrders {
+		if order.OrderID == orderID {
+			s.backOrders = append(s.backOrders[:i:i], s.backOrders[i+1:]...)
+			return
+		}
+	}
+}
+
+// beerStockEvents are all events which can be applied to BeerStock.
+var beerStockEvents = []proto.Message{
+	&events.BeerRestocked{},
+	&events.BeerOrdered{},
+	&events.BeerOutOfStock{},
+	&events.BeerOrderCancelled{},
+	&events.StockLow{},
+}
+
+// beerStockSnapshot is the state of BeerStock saved in the snapshot.
+type beerStockSnapshot struct {
+	BeerType     string            `json:"beer_type"`
+	Stock        int64             `json:"stock"`
+	BackOrders   []beerBackOrder   `json:"back_orders"`
+	RecentOrders []recentBeerOrder `json:"recent_orders"`
+}
+
+func (s *BeerStock) snapshot() beerStockSnapshot {
+	return beerStockSnapshot{
+		BeerType:     s.beerType,
+		Stock:        s.stock,
+		BackOrders:   s.backOrders,
+		RecentOrders: s.recentOrders,
+	}
+}
+
+func beerStockFromSnapshot(snapshot beerStockSnapshot, version int64) *BeerStock {
+	return &BeerStock{
+		beerType:     snapshot.BeerType,
+		stock:        snapshot.Stock,
+		backOrders:   snapshot.BackOrders,
+		recentOrders: snapshot.RecentOrders,
+		version:      version,
+	}
+}
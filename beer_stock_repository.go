@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"google.golang.org/protobuf/proto"
+)
+
+// beerStockSnapshotInterval is the number of events after which a new snapshot of BeerStock is saved,
+// stock has an event for every order, so its stream grows faster than the stream of a reservation.
+const beerStockSnapshotInterval = 50
+
+// BeerStockRepository loads BeerStock aggregate from EventStore and saves its new events.
+type BeerStockRepository struct {
+	eventSourcedRepository
+}
+
+func NewBeerStockRepository(
+	db *sql.DB,
+	eventStore EventStore,
+	snapshots SnapshotStore,
+	eventBus *cqrs.EventBus,
+	marshaler cqrs.CommandEventMarshaler,
+) *BeerStockRepository {
+	return &BeerStockRepository{eventSourcedRepository{
+		db:               db,
+		eventStore:       eventStore,
+		snapshots:        snapshots,
+		eventBus:         eventBus,
+		marshaler:        marshaler,
+		snapshotInterval: beerStockSnapshotInterval,
+	}}
+}
+
+// Load rebuilds BeerStock from the latest snapshot and events recorded after it.
+// Beer which was never restocked has empty stock.
+func (r *BeerStockRepository) Load(ctx context.Context, beerType string) (*BeerStock, error) {
+	var snapshot beerStockSnapshot
+	stock := NewBeerStock(beerType)
+
+	_, err := r.load(
+		ctx,
+		beerStockStreamID(beerType),
+		&snapshot,
+		beerStockEvents,
+		func(version int64) {
+			stock = beerStockFromSnapshot(snapshot, version)
+		},
+		func(event proto.Message, version int64) {
+			stock.apply(event)
+			stock.version = version
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return stock, nil
+}
+
+// Save publishes events recorded by the stock.
+// ErrConcurrencyConflict is returned when the stock was modified after it was loaded,
+// so two orders can't take the same beer.
+func (r *BeerStockRepository) Save(ctx context.Context, stock *BeerStock) error {
+	version, err := r.save(
+		ctx,
+		beerStockStreamID(stock.BeerType()),
+		stock.version,
+		stock.changes,
+		func() interface{} { return stock.snapshot() },
+	)
+	if err != nil {
+		return err
+	}
+
+	stock.version = version
+	stock.changes = nil
+
+	return nil
+}
+
+// beerStockStreamID returns id of the event store stream with events of the beer stock.
+func beerStockStreamID(beerType string) string {
+	return "beer-stock-" + beerType
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"main.go/events"
+	"testing"
+)
+
+func TestBeerStock_Order(t *testing.T) {
+	stock := NewBeerStock("lager")
+	if _, err := stock.Restock(12, 10); err != nil {
+		t.Fatal(err)
+	}
+	stock.changes = nil
+
+	served, err := stock.Order("1", "101", "", 3, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !served || stock.Stock() != 9 {
+		t.Errorf("expected order to be served from the stock, got served %t and stock %d", served, stock.Stock())
+	}
+	if len(stock.changes) != 2 {
+		t.Fatalf("expected BeerOrdered and StockLow, got %d events", len(stock.changes))
+	}
+	if _, ok := stock.changes[1].(*events.StockLow); !ok {
+		t.Errorf("expected StockLow, got %T", stock.changes[1])
+	}
+
+	// StockLow is recorded only when the stock drops below the threshold
+	stock.changes = nil
+	if _, err := stock.Order("2", "101", "", 3, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(stock.changes) != 1 {
+		t.Errorf("expected only BeerOrdered, got %d events", len(stock.changes))
+	}
+
+	if _, err := stock.Order("3", "101", "", 0, 10); err == nil {
+		t.Error("expected error for zero count")
+	}
+}
+
+func TestBeerStock_Order_outOfStock(t *testing.T) {
+	stock := NewBeerStock("lager")
+	if _, err := stock.Restock(2, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	served, err := stock.Order("1", "101", "", 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if served || stock.Stock() != 2 || stock.BackOrders() != 1 {
+		t.Errorf("expected back-order, got served %t, stock %d and %d back-orders", served, stock.Stock(), stock.BackOrders())
+	}
+
+	// orders which are waiting are served first
+	served, err = stock.Order("2", "102", "", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if served || stock.BackOrders() != 2 {
+		t.Errorf("expected order to wait for back-order, got served %t and %d back-orders", served, stock.BackOrders())
+	}
+}
+
+func TestBeerStock_Restock(t *testing.T) {
+	stock := NewBeerStock("lager")
+	for i, count := range []int64{5, 2, 1} {
+		if _, err := stock.Order(fmt.Sprint(i+1), "101", "", count, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first order waits for more beer and the rest waits for it
+	served, err := stock.Restock(4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(served) != 0 || stock.BackOrders() != 3 {
+		t.Errorf("expected no served orders and 3 back-orders, got %d served and %d back-orders", len(served), stock.BackOrders())
+	}
+
+	served, err = stock.Restock(3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(served) != 2 || served[0].OrderId != "1" || served[1].OrderId != "2" {
+		t.Errorf("expected orders 1 and 2 to be served, got %v", served)
+	}
+	if stock.Stock() != 0 || stock.BackOrders() != 1 {
+		t.Errorf("expected empty stock and 1 back-order, got stock %d and %d back-orders", stock.Stock(), stock.BackOrders())
+	}
+}
+
+func TestBeerStock_snapshot(t *testing.T) {
+	stock := NewBeerStock("lager")
+	if _, err := stock.Restock(2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stock.Order("1", "101", "reservation-1", 5, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := beerStockFromSnapshot(stock.snapshot(), 2)
+	served, err := restored.Restock(3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(served) != 1 || served[0].RoomId != "101" || served[0].ReservationId != "reservation-1" {
+		t.Errorf("expected back-order to be served after restoring, got %v", served)
+	}
+}
+
+func TestBeerStock_CancelBackOrders(t *testing.T) {
+	stock := NewBeerStock("lager")
+	if _, err := stock.Restock(3, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stock.Order("1", "101", "reservation-1", 5, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stock.Order("2", "102", "reservation-2", 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stock.Order("3", "101", "reservation-1", 1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if cancelled, _ := stock.CancelBackOrders("", 0); cancelled != 0 {
+		t.Errorf("orders not ordered by a reservation should not be cancelled, got %d cancelled", cancelled)
+	}
+
+	// order of reservation-2 was waiting for the first order of reservation-1
+	cancelled, served := stock.CancelBackOrders("reservation-1", 0)
+	if cancelled != 2 {
+		t.Errorf("expected 2 cancelled orders, got %d", cancelled)
+	}
+	if len(served) != 1 || served[0].OrderId != "2" {
+		t.Errorf("expected order 2 to be served, got %v", served)
+	}
+	if stock.Stock() != 1 || stock.BackOrders() != 0 {
+		t.Errorf("expected stock 1 and no back-orders, got stock %d and %d back-orders", stock.Stock(), stock.BackOrders())
+	}
+
+	if cancelled, _ := stock.CancelBackOrders("reservation-1", 0); cancelled != 0 {
+		t.Errorf("cancelled orders should not be cancelled again, got %d cancelled", cancelled)
+	}
+}
+
+func TestBeerStock_Order_redelivered(t *testing.T) {
+	stock := NewBeerStock("lager")
+	if _, err := stock.Restock(3, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stock.Order("1", "101", "", 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stock.Order("2", "102", "", 5, 0); err != nil {
+		t.Fatal(err)
+	}
+	stock.changes = nil
+
+	served, err := stock.Order("1", "101", "", 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !served || stock.Stock() != 1 {
+		t.Errorf("served order should be served only once, got served %t and stock %d", served, stock.Stock())
+	}
+
+	served, err = stock.Order("2", "102", "", 5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if served || stock.BackOrders() != 1 {
+		t.Errorf("back-ordered order should be back-ordered only once, got served %t and %d back-orders", served, stock.BackOrders())
+	}
+
+	if len(stock.changes) != 0 {
+		t.Errorf("redelivered orders should not record events, got %d events", len(stock.changes))
+	}
+
+	// served orders are remembered also in the snapshot
+	restored := beerStockFromSnapshot(stock.snapshot(), 4)
+	if _, err := restored.Restock(2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restored.Order("1", "101", "", 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Stock() != 3 {
+		t.Errorf("served order should not be served again after restoring, got stock %d", restored.Stock())
+	}
+}
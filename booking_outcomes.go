@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"main.go/events"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+)
+
+// bookingWaitTimeout is how long API waits for the booking outcome.
+const bookingWaitTimeout = 10 * time.Second
+
+// BookingOutcome is the result of BookRoom command.
+type BookingOutcome struct {
+	ReservationID   string
+	Booked          bool
+	RejectionReason events.BookingRejectionReason
+}
+
+// BookingOutcomes allows to wait for the result of BookRoom command, it's used by HTTP and gRPC API.
+//
+// It listens for RoomBooked and BookingRejected events and passes them to whoever waits for the reservation.
+type BookingOutcomes struct {
+	waiters map[string]chan BookingOutcome
+	lock    sync.Mutex
+}
+
+func NewBookingOutcomes() *BookingOutcomes {
+	return &BookingOutcomes{waiters: map[string]chan BookingOutcome{}}
+}
+
+// Wait returns channel, which receives the outcome of booking with the given reservation id.
+// It must be called before the command is sent, so the outcome is not missed.
+// Returned function must be called when the caller doesn't wait anymore.
+func (b *BookingOutcomes) Wait(reservationID string) (<-chan BookingOutcome, func()) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	// buffered, so the event handler is never blocked by the waiter which already gave up
+	outcome := make(chan BookingOutcome, 1)
+	b.waiters[reservationID] = outcome
+
+	return outcome, func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+
+		delete(b.waiters, reservationID)
+	}
+}
+
+func (b *BookingOutcomes) notify(outcome BookingOutcome) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	waiter, ok := b.waiters[outcome.ReservationID]
+	if !ok {
+		return
+	}
+
+	select {
+	case waiter <- outcome:
+	default:
+		// already notified by redelivered event
+	}
+}
+
+func (b *BookingOutcomes) EventHandlers() []cqrs.EventHandler {
+	return []cqrs.EventHandler{
+		eventHandler{
+			name:     "BookingOutcomesOnRoomBooked",
+			newEvent: func() interface{} { return &events.RoomBooked{} },
+			handle: func(ctx context.Context, e interface{}) error {
+				event := e.(*events.RoomBooked)
+
+				b.notify(BookingOutcome{ReservationID: event.ReservationId, Booked: true})
+				return nil
+			},
+		},
+		eventHandler{
+			name:     "BookingOutcomesOnBookingRejected",
+			newEvent: func() interface{} { return &events.BookingRejected{} },
+			handle: func(ctx context.Context, e interface{}) error {
+				event := e.(*events.BookingRejected)
+
+				b.notify(BookingOutcome{ReservationID: event.ReservationId, RejectionReason: event.Reason})
+				return nil
+			},
+		},
+	}
+}
+
+// BookRoomResult is the result of sending BookRoom command by the API.
+type BookRoomResult struct {
+	CommandID     string
+	ReservationID string
+	// Outcome is nil when the API didn't wait for it, it didn't arrive on time or the request was cancelled while waiting
+	Outcome *BookingOutcome
+}
+
+// sendBookRoom sends BookRoom command with newly assigned reservation id.
+// When wait is true, it waits up to bookingWaitTimeout for the outcome of the booking.
+//
+// It's shared by HTTP and gRPC API.
+func sendBookRoom(
+	ctx context.Context,
+	commandBus *cqrs.CommandBus,
+	outcomes *BookingOutcomes,
+	cmd *events.BookRoom,
+	wait bool,
+) (BookRoomResult, error) {
+	result := BookRoomResult{
+		CommandID: watermill.NewUUID(),
+		// reservation id is assigned here, so we know which RoomBooked or BookingRejected we are waiting for
+		ReservationID: watermill.NewUUID(),
+	}
+	cmd.ReservationId = result.ReservationID
+
+	var outcome <-chan BookingOutcome
+	if wait {
+		var stopWaiting func()
+		outcome, stopWaiting = outcomes.Wait(result.ReservationID)
+		defer stopWaiting()
+	}
+
+	if err := commandBus.Send(WithMessageUUID(ctx, result.CommandID), cmd); err != nil {
+		return BookRoomResult{}, err
+	}
+
+	if !wait {
+		return result, nil
+	}
+
+	select {
+	case o := <-outcome:
+		result.Outcome = &o
+	case <-time.After(bookingWaitTimeout):
+		// command is still going to be handled, client can check the reservation later
+	case <-ctx.Done():
+		// the command was already sent, so the booking is pending like after the timeout;
+		// returning an error would make the client retry and book the room twice
+	}
+
+	return result, nil
+}
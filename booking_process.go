@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"main.go/events"
+	"math/rand"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+)
+
+// bookingProcessName is the name of BookingProcess in ProcessStore.
+const bookingProcessName = "BookingProcess"
+
+type BookingProcessStep string
+
+const (
+	BookingOrderingBeer    BookingProcessStep = "ordering_beer"
+	BookingBeerBackOrdered BookingProcessStep = "beer_back_ordered"
+	BookingCompleted       BookingProcessStep = "completed"
+	BookingCompensated     BookingProcessStep = "compensated"
+)
+
+// bookingProcessState is the state of BookingProcess of one reservation.
+type bookingProcessState struct {
+	ReservationID string `json:"reservation_id"`
+	RoomID        string `json:"room_id"`
+	GuestName     string `json:"guest_name"`
+	// BeerType is the type of the ordered beer, its back-order is cancelled when the guest is compensated
+	BeerType string             `json:"beer_type"`
+	Step     BookingProcessStep `json:"step"`
+	// BeerDeadline is when the guest is compensated, if the welcome beer is not served yet
+	BeerDeadline time.Time `json:"beer_deadline"`
+}
+
+func (s *bookingProcessState) Deadline() time.Time {
+	if s.waitingForBeer() {
+		return s.BeerDeadline
+	}
+
+	return time.Time{}
+}
+
+func (s *bookingProcessState) waitingForBeer() bool {
+	return s.Step == BookingOrderingBeer || s.Step == BookingBeerBackOrdered
+}
+
+// BookingProcess orders the welcome beer when the guest checks in and waits until it's served.
+//
+// Beer which is out of stock is back-ordered, and it's served when the bar is restocked.
+// When it's not served within config.BeerTimeout, or OrderBeer fails (BeerOrderFailed is emitted for invalid
+// and dead lettered orders), the guest is notified and credited with config.BeerCredit, and the back-order is cancelled,
+// so the guest doesn't get both. Beer which was served before the back-order was cancelled is not taken back.
+// Bookings which were cancelled never reach check-in, so they don't get the beer.
+type BookingProcess struct {
+	manager   *ProcessManager
+	config    BookingProcessConfig
+	beerTypes []string
+}
+
+func NewBookingProcess(
+	db *sql.DB,
+	store *ProcessStore,
+	commandBus *cqrs.CommandBus,
+	config BookingProcessConfig,
+	beerTypes []string,
+) *BookingProcess {
+	p := &BookingProcess{config: config, beerTypes: beerTypes}
+	p.manager = NewProcessManager(
+		bookingProcessName,
+		db,
+		store,
+		commandBus,
+		func() ProcessState { return &bookingProcessState{} },
+		p.onTimeout,
+	)
+
+	return p
+}
+
+// EventHandlers returns handlers of all events of the process.
+func (p *BookingProcess) EventHandlers() []cqrs.EventHandler {
+	return []cqrs.EventHandler{
+		p.manager.StartOn(
+			func() interface{} { return &events.GuestCheckedIn{} },
+			func(e interface{}) string { return e.(*events.GuestCheckedIn).ReservationId },
+			p.onGuestCheckedIn,
+		),
+		p.manager.On(
+			func() interface{} { return &events.BeerOrdered{} },
+			func(e interface{}) string { return e.(*events.BeerOrdered).ReservationId },
+			p.onBeerOrdered,
+		),
+		p.manager.On(
+			func() interface{} { return &events.BeerOutOfStock{} },
+			func(e interface{}) string { return e.(*events.BeerOutOfStock).ReservationId },
+			p.onBeerOutOfStock,
+		),
+		p.manager.On(
+			func() interface{} { return &events.BeerOrderFailed{} },
+			func(e interface{}) string { return e.(*events.BeerOrderFailed).ReservationId },
+			p.onBeerOrderFailed,
+		),
+	}
+}
+
+// RunTimeouts compensates processes, which didn't get the beer on time, until ctx is done.
+func (p *BookingProcess) RunTimeouts(ctx context.Context) {
+	p.manager.RunTimeouts(ctx, p.config.TimeoutsInterval)
+}
+
+func (p *BookingProcess) onGuestCheckedIn(ctx context.Context, s ProcessState, e interface{}) ([]interface{}, error) {
+	state := s.(*bookingProcessState)
+	event := e.(*events.GuestCheckedIn)
+
+	state.ReservationID = event.ReservationId
+	state.RoomID = event.RoomId
+	state.GuestName = event.GuestName
+	state.BeerType = p.beerTypes[rand.Intn(len(p.beerTypes))]
+	state.Step = BookingOrderingBeer
+	state.BeerDeadline = time.Now().Add(p.config.BeerTimeout)
+
+	return []interface{}{&events.OrderBeer{
+		RoomId:        event.RoomId,
+		Count:         rand.Int63n(10) + 1,
+		BeerType:      state.BeerType,
+		ReservationId: event.ReservationId,
+	}}, nil
+}
+
+func (p *BookingProcess) onBeerOrdered(ctx context.Context, s ProcessState, e interface{}) ([]interface{}, error) {
+	state := s.(*bookingProcessState)
+
+	if !state.waitingForBeer() {
+		// for example the beer was served after the guest was compensated
+		logf(ctx, "Welcome beer of reservation %s served in step %s, ignoring", state.ReservationID, state.Step)
+		return nil, nil
+	}
+
+	state.Step = BookingCompleted
+	return nil, nil
+}
+
+func (p *BookingProcess) onBeerOutOfStock(ctx context.Context, s ProcessState, e interface{}) ([]interface{}, error) {
+	state := s.(*bookingProcessState)
+
+	switch state.Step {
+	case BookingOrderingBeer:
+		// waiting for restock until the deadline
+		state.Step = BookingBeerBackOrdered
+	case BookingCompensated:
+		// OrderBeer was handled after the deadline, the guest is already compensated
+		return []interface{}{p.cancelBeerOrder(state)}, nil
+	}
+
+	return nil, nil
+}
+
+func (p *BookingProcess) onBeerOrderFailed(ctx context.Context, s ProcessState, e interface{}) ([]interface{}, error) {
+	state := s.(*bookingProcessState)
+	event := e.(*events.BeerOrderFailed)
+
+	if !state.waitingForBeer() {
+		logf(ctx, "Welcome beer order of reservation %s failed in step %s, ignoring", state.ReservationID, state.Step)
+		return nil, nil
+	}
+
+	logf(
+		ctx,
+		"Welcome beer order of reservation %s failed (%s), compensating with $%d credit",
+		state.ReservationID, event.Reason, p.config.BeerCredit,
+	)
+	return p.compensate(state), nil
+}
+
+func (p *BookingProcess) onTimeout(ctx context.Context, s ProcessState, _ interface{}) ([]interface{}, error) {
+	state := s.(*bookingProcessState)
+
+	logf(
+		ctx,
+		"Welcome beer of reservation %s was not served within %s, compensating with $%d credit",
+		state.ReservationID, p.config.BeerTimeout, p.config.BeerCredit,
+	)
+	return p.compensate(state), nil
+}
+
+// compensate notifies the guest, who didn't get the beer, credits the reservation and cancels the back-order.
+func (p *BookingProcess) compensate(state *bookingProcessState) []interface{} {
+	var commands []interface{}
+	if state.Step == BookingBeerBackOrdered {
+		// cancelled first, so the back-order is less likely to be served while the guest is compensated
+		commands = append(commands, p.cancelBeerOrder(state))
+	}
+
+	commands = append(
+		commands,
+		&events.NotifyGuest{
+			ReservationId: state.ReservationID,
+			RoomId:        state.RoomID,
+			GuestName:     state.GuestName,
+			Message: fmt.Sprintf(
+				"We are sorry, your welcome beer could not be served. $%d was credited to your reservation.",
+				p.config.BeerCredit,
+			),
+		},
+		&events.ApplyCredit{
+			ReservationId: state.ReservationID,
+			Amount:        p.config.BeerCredit,
+			Reason:        "welcome beer not served",
+		},
+	)
+
+	state.Step = BookingCompensated
+	return commands
+}
+
+func (p *BookingProcess) cancelBeerOrder(state *bookingProcessState) *events.CancelBeerOrder {
+	return &events.CancelBeerOrder{
+		ReservationId: state.ReservationID,
+		BeerType:      state.BeerType,
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// runCLICommand runs maintenance command passed as program arguments, for example:
+//
+//	go run . rebuild-financial-report
+//
+// Commands are using the same config as the service, so flags must be before the command:
+//
+//	go run . --projection-store bolt rebuild-financial-report
+func runCLICommand(ctx context.Context, config Config, args []string) error {
+	switch args[0] {
+	case "rebuild-financial-report":
+		return rebuildFinancialReport(ctx, config)
+	case "dlq":
+		return runDeadLettersCommand(ctx, config, args[1:])
+	default:
+		return errors.Errorf("unknown command %q, available commands: rebuild-financial-report, dlq", args[0])
+	}
+}
+
+// rebuildFinancialReport replays all events from the event store to recreate BookingsFinancialReport.
+// The service should be stopped, otherwise it may overwrite the rebuilt report.
+func rebuildFinancialReport(ctx context.Context, config Config) error {
+	db, err := openDatabase(config.Database.Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	eventStore, err := NewSQLiteEventStore(db)
+	if err != nil {
+		return err
+	}
+	projectionStore, err := NewProjectionStore(config.Projections.Store, db, config.Projections.BoltPath)
+	if err != nil {
+		return err
+	}
+	defer projectionStore.Close()
+
+	totalCharge, err := RebuildBookingsFinancialReport(ctx, eventStore, projectionStore, ProtobufMarshaler{})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Financial report rebuilt, total charge: $%d\n", totalCharge)
+	return nil
+}
+
+const deadLettersUsage = `usage:
+	dlq list                list all dead letters
+	dlq inspect <id>        show dead letter with its command and metadata
+	dlq replay <id>...      send dead letters again to their topics`
+
+// runDeadLettersCommand lists, inspects and replays commands, which were moved to dead letters.
+func runDeadLettersCommand(ctx context.Context, config Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(deadLettersUsage)
+	}
+
+	db, err := openDatabase(config.Database.Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	store, err := NewDeadLetterStore(db)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int64, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return errors.Errorf("invalid dead letter id %q", arg)
+		}
+		ids = append(ids, id)
+	}
+
+	switch {
+	case args[0] == "list" && len(ids) == 0:
+		return listDeadLetters(ctx, store)
+	case args[0] == "inspect" && len(ids) == 1:
+		return inspectDeadLetter(ctx, store, ids[0])
+	case args[0] == "replay" && len(ids) > 0:
+		return replayDeadLetters(ctx, config, store, ids)
+	default:
+		return errors.New(deadLettersUsage)
+	}
+}
+
+func listDeadLetters(ctx context.Context, store *DeadLetterStore) error {
+	deadLetters, err := store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCOMMAND\tHANDLER\tATTEMPTS\tCREATED\tREPLAYED\tREASON")
+	for _, d := range deadLetters {
+		replayed := "-"
+		if d.ReplayedAt != nil {
+			replayed = d.ReplayedAt.Local().Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(
+			w, "%d\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			d.ID, d.Metadata["name"], d.Handler, d.Attempts, d.CreatedAt.Local().Format(time.RFC3339), replayed, d.Reason,
+		)
+	}
+
+	return w.Flush()
+}
+
+func inspectDeadLetter(ctx context.Context, store *DeadLetterStore, id int64) error {
+	d, err := store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("ID:        %d\n", d.ID)
+	fmt.Printf("UUID:      %s\n", d.UUID)
+	fmt.Printf("Topic:     %s\n", d.Topic)
+	fmt.Printf("Handler:   %s\n", d.Handler)
+	fmt.Printf("Attempts:  %d\n", d.Attempts)
+	fmt.Printf("Reason:    %s\n", d.Reason)
+	fmt.Printf("Created:   %s\n", d.CreatedAt.Local().Format(time.RFC3339))
+	if d.ReplayedAt != nil {
+		fmt.Printf("Replayed:  %s\n", d.ReplayedAt.Local().Format(time.RFC3339))
+	}
+
+	fmt.Println("Metadata:")
+	keys := make([]string, 0, len(d.Metadata))
+	for key := range d.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("  %s: %s\n", key, d.Metadata[key])
+	}
+
+	command, ok, err := decodeStoredEvent(ProtobufMarshaler{}, StoredEvent{
+		UUID:    d.UUID,
+		Name:    d.Metadata["name"],
+		Payload: d.Payload,
+	}, allCommands)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Printf("Payload:   %d bytes of unknown message\n", len(d.Payload))
+		return nil
+	}
+
+	fmt.Printf("Command:   %s\n", protojson.Format(command))
+	return nil
+}
+
+// replayDeadLetters sends dead letters again to the topics, from which they were received.
+func replayDeadLetters(ctx context.Context, config Config, store *DeadLetterStore, ids []int64) error {
+	if config.Transport.Kind == "gochannel" {
+		return errors.New("dead letters can't be replayed with gochannel transport, it works only within the service")
+	}
+
+	transport, err := NewTransport(config.Transport, watermill.NopLogger{})
+	if err != nil {
+		return err
+	}
+	defer transport.Close()
+
+	for _, id := range ids {
+		d, err := store.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if d.ReplayedAt != nil {
+			return errors.Errorf("dead letter %d was already replayed", id)
+		}
+
+		if err := transport.CommandsPublisher().Publish(d.Topic, d.Message()); err != nil {
+			return errors.Wrapf(err, "cannot replay dead letter %d", id)
+		}
+		if err := store.MarkReplayed(ctx, id); err != nil {
+			return err
+		}
+
+		fmt.Printf("Dead letter %d replayed to %s\n", id, d.Topic)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// CorrelationIDKey is metadata key with id of the request which started the whole flow.
+	// It's the UUID of the first command, when the request didn't have its own id.
+	CorrelationIDKey = middleware.CorrelationIDMetadataKey
+	// CausationIDKey is metadata key with UUID of the message, by which handling the message was sent.
+	CausationIDKey = "causation_id"
+
+	// correlationIDHeader is HTTP header (and gRPC metadata key) with correlation id of the request.
+	correlationIDHeader = "X-Correlation-ID"
+)
+
+type correlationIDCtxKey struct{}
+
+// WithCorrelationID sets correlation id of messages sent with this context.
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDCtxKey{}, correlationID)
+}
+
+// CorrelationID returns correlation id set by WithCorrelationID or CorrelationMiddleware.
+func CorrelationID(ctx context.Context) (string, bool) {
+	correlationID, ok := ctx.Value(correlationIDCtxKey{}).(string)
+	return correlationID, ok && correlationID != ""
+}
+
+// CorrelationMiddleware is router middleware, which sets correlation id of the handled message in its context,
+// so it's inherited by all messages sent by the handler.
+//
+// Causation id of the sent messages is UUID of the handled message (see HandledMessageUUIDMiddleware).
+func CorrelationMiddleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		correlationID := msg.Metadata.Get(CorrelationIDKey)
+		if correlationID == "" {
+			// message from an external producer, which doesn't set correlation id, starts a new flow
+			correlationID = msg.UUID
+		}
+
+		msg.SetContext(WithCorrelationID(msg.Context(), correlationID))
+		return h(msg)
+	}
+}
+
+// CorrelationPublisher is message.Publisher decorator, which sets correlation and causation id of every message
+// from the message context (which is the context passed to cqrs.CommandBus.Send or cqrs.EventBus.Publish).
+//
+// Message sent outside of a handler starts a new flow: it's its own correlation id and it has no causation id.
+type CorrelationPublisher struct {
+	publisher message.Publisher
+}
+
+func NewCorrelationPublisher(publisher message.Publisher) CorrelationPublisher {
+	return CorrelationPublisher{publisher}
+}
+
+func (p CorrelationPublisher) Publish(topic string, messages ...*message.Message) error {
+	for _, msg := range messages {
+		correlationID, ok := CorrelationID(msg.Context())
+		if !ok {
+			correlationID = msg.UUID
+		}
+		msg.Metadata.Set(CorrelationIDKey, correlationID)
+
+		if causationID, ok := HandledMessageUUID(msg.Context()); ok {
+			msg.Metadata.Set(CausationIDKey, causationID)
+		}
+	}
+
+	return p.publisher.Publish(topic, messages...)
+}
+
+func (p CorrelationPublisher) Close() error {
+	return p.publisher.Close()
+}
+
+// correlationIDFromHTTP is HTTP middleware, which passes correlation id from X-Correlation-ID header
+// to the commands sent by the request.
+func correlationIDFromHTTP(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if correlationID := r.Header.Get(correlationIDHeader); correlationID != "" {
+			r = r.WithContext(WithCorrelationID(r.Context(), correlationID))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// correlationIDFromGRPC is gRPC interceptor, which passes correlation id from x-correlation-id metadata
+// to the commands sent by the call.
+func correlationIDFromGRPC(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(correlationIDHeader); len(values) > 0 && values[0] != "" {
+		ctx = WithCorrelationID(ctx, values[0])
+	}
+
+	return handler(ctx, req)
+}
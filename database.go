@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	// SQLite driver, it requires cgo
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openDatabase opens SQLite database used for storing events.
+func openDatabase(path string) (*sql.DB, error) {
+	// _txlock=immediate takes the write lock when transaction starts,
+	// so concurrent handlers are waiting for each other (up to busy timeout) instead of failing on upgrade of the lock
+	dsn := fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate", path)
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows only one writer at a time
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+type txCtxKey struct{}
+
+// runInTx runs fn in a transaction, which is passed to fn in the context (see txFromContext).
+// The transaction is committed when fn succeeds and rolled back otherwise.
+//
+// When ctx already has a transaction, fn joins it and the transaction is committed by its owner.
+func runInTx(ctx context.Context, db *sql.DB, fn func(ctx context.Context) error) (err error) {
+	if _, ok := txFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "cannot begin transaction")
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txCtxKey{}, tx)); err != nil {
+		return err
+	}
+
+	return errors.Wrap(tx.Commit(), "cannot commit transaction")
+}
+
+// txFromContext returns transaction started by runInTx.
+//
+// Database allows only one open connection, so everything done within the transaction must use it,
+// querying the database directly would wait for the transaction forever.
+func txFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txCtxKey{}).(*sql.Tx)
+	return tx, ok
+}
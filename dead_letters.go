@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/pkg/errors"
+)
+
+// AttemptsKey is metadata key with the number of attempts to handle the message.
+const AttemptsKey = "attempts"
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetterMiddleware retries failed command handlers with exponential backoff.
+// When the last retry fails, the command is moved to the dead letter topic, so it's not redelivered forever.
+//
+// Dead lettered message has the same metadata as middleware.PoisonQueue (error, topic and handler) and AttemptsKey.
+type DeadLetterMiddleware struct {
+	retry     middleware.Retry
+	publisher message.Publisher
+	topic     string
+
+	// commandHandlers are names of handlers using this middleware, event handlers are retried by redelivery
+	commandHandlers map[string]bool
+}
+
+func NewDeadLetterMiddleware(
+	config RetryConfig,
+	publisher message.Publisher,
+	topic string,
+	commandHandlers map[string]bool,
+) DeadLetterMiddleware {
+	return DeadLetterMiddleware{
+		retry: middleware.Retry{
+			MaxRetries:      config.MaxRetries,
+			InitialInterval: config.InitialInterval,
+			MaxInterval:     config.MaxInterval,
+			Multiplier:      config.Multiplier,
+		},
+		publisher:       publisher,
+		topic:           topic,
+		commandHandlers: commandHandlers,
+	}
+}
+
+func (m DeadLetterMiddleware) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	withRetries := m.retry.Middleware(countAttempts(h))
+
+	return func(msg *message.Message) ([]*message.Message, error) {
+		if !m.commandHandlers[message.HandlerNameFromCtx(msg.Context())] {
+			return h(msg)
+		}
+
+		produced, err := withRetries(msg)
+		if err == nil {
+			return produced, nil
+		}
+
+		if msg.Context().Err() != nil {
+			// retries were interrupted by shutdown, the command will be handled again after restart
+			return nil, err
+		}
+
+		if publishErr := m.publishDeadLetter(msg, err); publishErr != nil {
+			return nil, publishErr
+		}
+
+		logf(
+			msg.Context(),
+			"Command %s moved to dead letters after %s attempts: %s",
+			msg.UUID, msg.Metadata.Get(AttemptsKey), err,
+		)
+		return nil, nil
+	}
+}
+
+func (m DeadLetterMiddleware) publishDeadLetter(msg *message.Message, err error) error {
+	msg.Metadata.Set(middleware.ReasonForPoisonedKey, err.Error())
+	msg.Metadata.Set(middleware.PoisonedTopicKey, message.SubscribeTopicFromCtx(msg.Context()))
+	msg.Metadata.Set(middleware.PoisonedHandlerKey, message.HandlerNameFromCtx(msg.Context()))
+	msg.Metadata.Set(middleware.PoisonedSubscriberKey, message.SubscriberNameFromCtx(msg.Context()))
+
+	return errors.Wrapf(m.publisher.Publish(m.topic, msg), "cannot publish dead letter %s", msg.UUID)
+}
+
+// countAttempts increments AttemptsKey every time the handler is called.
+func countAttempts(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		attempts, _ := strconv.Atoi(msg.Metadata.Get(AttemptsKey))
+		msg.Metadata.Set(AttemptsKey, strconv.Itoa(attempts+1))
+
+		return h(msg)
+	}
+}
+
+// DeadLetter is a message, which was not handled after all retries.
+type DeadLetter struct {
+	ID         int64
+	UUID       string
+	Topic      string
+	Handler    string
+	Reason     string
+	Attempts   int
+	Payload    []byte
+	Metadata   map[string]string
+	CreatedAt  time.Time
+	ReplayedAt *time.Time
+}
+
+// DeadLetterStore keeps dead letters in SQLite, so they can be listed, inspected and replayed with CLI.
+type DeadLetterStore struct {
+	db *sql.DB
+}
+
+func NewDeadLetterStore(db *sql.DB) (*DeadLetterStore, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS dead_letters (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			uuid TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			handler TEXT NOT NULL,
+			reason TEXT NOT NULL,
+			attempts INTEGER NOT NULL,
+			payload BLOB NOT NULL,
+			metadata TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			replayed_at TIMESTAMP
+		)`,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create dead_letters table")
+	}
+
+	return &DeadLetterStore{db}, nil
+}
+
+// Handler is router handler, which stores messages from dead letter topic.
+func (s *DeadLetterStore) Handler(msg *message.Message) error {
+	return s.Add(msg.Context(), msg)
+}
+
+// Add stores dead lettered message.
+// Redelivered message is stored only once, until it's replayed.
+func (s *DeadLetterStore) Add(ctx context.Context, msg *message.Message) error {
+	metadata, err := json.Marshal(msg.Metadata)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal metadata")
+	}
+
+	attempts, _ := strconv.Atoi(msg.Metadata.Get(AttemptsKey))
+	handler := msg.Metadata.Get(middleware.PoisonedHandlerKey)
+
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO dead_letters (uuid, topic, handler, reason, attempts, payload, metadata, created_at)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (
+			SELECT 1 FROM dead_letters WHERE uuid = ? AND handler = ? AND replayed_at IS NULL
+		)`,
+		msg.UUID,
+		msg.Metadata.Get(middleware.PoisonedTopicKey),
+		handler,
+		msg.Metadata.Get(middleware.ReasonForPoisonedKey),
+		attempts,
+		[]byte(msg.Payload),
+		string(metadata),
+		time.Now().UTC(),
+		msg.UUID,
+		handler,
+	)
+	return errors.Wrapf(err, "cannot store dead letter %s", msg.UUID)
+}
+
+// List returns all dead letters, the oldest first.
+func (s *DeadLetterStore) List(ctx context.Context) ([]DeadLetter, error) {
+	return s.query(ctx, `SELECT `+deadLetterColumns+` FROM dead_letters ORDER BY id`)
+}
+
+func (s *DeadLetterStore) Get(ctx context.Context, id int64) (DeadLetter, error) {
+	deadLetters, err := s.query(ctx, `SELECT `+deadLetterColumns+` FROM dead_letters WHERE id = ?`, id)
+	if err != nil {
+		return DeadLetter{}, err
+	}
+	if len(deadLetters) == 0 {
+		return DeadLetter{}, errors.Wrapf(ErrDeadLetterNotFound, "dead letter %d", id)
+	}
+
+	return deadLetters[0], nil
+}
+
+// MarkReplayed marks dead letter as sent again to its topic.
+func (s *DeadLetterStore) MarkReplayed(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE dead_letters SET replayed_at = ? WHERE id = ?`, time.Now().UTC(), id)
+	return errors.Wrapf(err, "cannot mark dead letter %d as replayed", id)
+}
+
+const deadLetterColumns = `id, uuid, topic, handler, reason, attempts, payload, metadata, created_at, replayed_at`
+
+func (s *DeadLetterStore) query(ctx context.Context, query string, args ...interface{}) ([]DeadLetter, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot query dead letters")
+	}
+	defer rows.Close()
+
+	var deadLetters []DeadLetter
+	for rows.Next() {
+		var deadLetter DeadLetter
+		var metadata string
+		var replayedAt sql.NullTime
+
+		if err := rows.Scan(
+			&deadLetter.ID,
+			&deadLetter.UUID,
+			&deadLetter.Topic,
+			&deadLetter.Handler,
+			&deadLetter.Reason,
+			&deadLetter.Attempts,
+			&deadLetter.Payload,
+			&metadata,
+			&deadLetter.CreatedAt,
+			&replayedAt,
+		); err != nil {
+			return nil, errors.Wrap(err, "cannot scan dead letter")
+		}
+
+		if err := json.Unmarshal([]byte(metadata), &deadLetter.Metadata); err != nil {
+			return nil, errors.Wrapf(err, "cannot unmarshal metadata of dead letter %d", deadLetter.ID)
+		}
+		if replayedAt.Valid {
+			deadLetter.ReplayedAt = &replayedAt.Time
+		}
+
+		deadLetters = append(deadLetters, deadLetter)
+	}
+
+	return deadLetters, errors.Wrap(rows.Err(), "cannot iterate dead letters")
+}
+
+// Message returns the message to be sent again to the original topic.
+// Metadata added by dead lettering is removed, so the command has all retries again.
+func (d DeadLetter) Message() *message.Message {
+	msg := message.NewMessage(d.UUID, d.Payload)
+
+	for key, value := range d.Metadata {
+		switch key {
+		case AttemptsKey,
+			middleware.ReasonForPoisonedKey,
+			middleware.PoisonedTopicKey,
+			middleware.PoisonedHandlerKey,
+			middleware.PoisonedSubscriberKey:
+			continue
+		}
+		msg.Metadata.Set(key, value)
+	}
+
+	return msg
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+)
+
+// eventHandler is cqrs.EventHandler built from functions.
+//
+// cqrs.EventHandler is handling only one event type (the one returned by NewEvent),
+// so read models which are interested in multiple events are exposing one eventHandler per each extra event.
+type eventHandler struct {
+	name     string
+	newEvent func() interface{}
+	handle   func(ctx context.Context, event interface{}) error
+}
+
+func (h eventHandler) HandlerName() string {
+	return h.name
+}
+
+func (h eventHandler) NewEvent() interface{} {
+	return h.newEvent()
+}
+
+func (h eventHandler) Handle(ctx context.Context, event interface{}) error {
+	return h.handle(ctx, event)
+}
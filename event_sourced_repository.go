@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// eventSourcedRepository has logic shared by repositories of event sourced aggregates:
+// loading them from the latest snapshot and newer events, and publishing their new events.
+//
+// New events are published with cqrs.EventBus, which is appending them to the event store and outbox
+// (see EventStorePublisher), so every event is both stored and delivered to event handlers.
+type eventSourcedRepository struct {
+	db         *sql.DB
+	eventStore EventStore
+	snapshots  SnapshotStore
+	eventBus   *cqrs.EventBus
+	marshaler  cqrs.CommandEventMarshaler
+
+	// snapshotInterval is the number of events after which a new snapshot is saved
+	snapshotInterval int64
+}
+
+// load loads the latest snapshot of the stream into snapshot and calls restore with its version, when it exists.
+// Then apply is called for every event recorded after the snapshot.
+// False is returned when the stream has neither snapshot nor events.
+func (r eventSourcedRepository) load(
+	ctx context.Context,
+	streamID string,
+	snapshot interface{},
+	eventTypes []proto.Message,
+	restore func(version int64),
+	apply func(event proto.Message, version int64),
+) (bool, error) {
+	version, err := r.snapshots.Load(ctx, streamID, snapshot)
+	if err != nil {
+		return false, err
+	}
+	if version > 0 {
+		restore(version)
+	}
+
+	storedEvents, err := r.eventStore.LoadStream(ctx, streamID, version)
+	if err != nil {
+		return false, err
+	}
+
+	for _, storedEvent := range storedEvents {
+		event, ok, err := decodeStoredEvent(r.marshaler, storedEvent, eventTypes)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, errors.Errorf("unknown event %s in stream %s", storedEvent.Name, streamID)
+		}
+
+		apply(event, storedEvent.Version)
+	}
+
+	return version > 0 || len(storedEvents) > 0, nil
+}
+
+// save publishes changes of the aggregate loaded at the given version and returns its new version.
+// ErrConcurrencyConflict is returned when the stream was modified after the aggregate was loaded.
+//
+// When snapshotInterval is crossed, snapshot returned by the snapshot function is saved.
+func (r eventSourcedRepository) save(
+	ctx context.Context,
+	streamID string,
+	version int64,
+	changes []proto.Message,
+	snapshot func() interface{},
+) (int64, error) {
+	// all new events are stored in one transaction, so the aggregate is never saved partially
+	err := runInTx(ctx, r.db, func(ctx context.Context) error {
+		expectedVersion := version
+		for _, event := range changes {
+			if err := r.eventBus.Publish(WithEventStream(ctx, streamID, expectedVersion), event); err != nil {
+				return err
+			}
+			expectedVersion++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return version, err
+	}
+	newVersion := version + int64(len(changes))
+
+	if version/r.snapshotInterval != newVersion/r.snapshotInterval {
+		if err := r.snapshots.Save(ctx, streamID, newVersion, snapshot()); err != nil {
+			// events are already stored, snapshot is just an optimisation
+			logf(ctx, "Cannot save snapshot of stream %s: %s", streamID, err)
+		}
+	}
+
+	return newVersion, nil
+}
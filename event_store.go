@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// AnyVersion can be passed as expected version when appending events, to skip optimistic concurrency check.
+const AnyVersion int64 = -1
+
+var ErrConcurrencyConflict = errors.New("stream was modified concurrently")
+
+// StoredEvent is an event persisted in EventStore.
+type StoredEvent struct {
+	// Position is global position of the event in the store, it is assigned by the store.
+	Position int64
+	StreamID string
+	// Version is position of the event in the stream, first event of the stream has version 1.
+	Version    int64
+	UUID       string
+	Name       string
+	Payload    []byte
+	Metadata   map[string]string
+	RecordedAt time.Time
+}
+
+// EventStore is an append-only log of all events, split into streams.
+type EventStore interface {
+	// Append appends events to the end of the stream.
+	//
+	// expectedVersion is the version of the stream known to the caller (0 for a new stream).
+	// When stream was modified in the meantime, ErrConcurrencyConflict is returned.
+	Append(ctx context.Context, streamID string, expectedVersion int64, events ...StoredEvent) error
+
+	// LoadStream returns events of the stream newer than fromVersion.
+	LoadStream(ctx context.Context, streamID string, fromVersion int64) ([]StoredEvent, error)
+
+	// LoadAll returns up to limit events of all streams, starting after fromPosition.
+	LoadAll(ctx context.Context, fromPosition int64, limit int) ([]StoredEvent, error)
+
+	// LoadStreams returns up to limit events of streams with id starting with streamPrefix, starting after fromPosition.
+	LoadStreams(ctx context.Context, streamPrefix string, fromPosition int64, limit int) ([]StoredEvent, error)
+}
+
+// SQLiteEventStore is EventStore keeping events in a single SQLite table.
+type SQLiteEventStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteEventStore(db *sql.DB) (*SQLiteEventStore, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS events (
+			position INTEGER PRIMARY KEY AUTOINCREMENT,
+			stream_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			uuid TEXT NOT NULL,
+			name TEXT NOT NULL,
+			payload BLOB NOT NULL,
+			metadata TEXT NOT NULL,
+			recorded_at TIMESTAMP NOT NULL,
+			UNIQUE (stream_id, version)
+		)`,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create events table")
+	}
+
+	return &SQLiteEventStore{db}, nil
+}
+
+// Append appends events in a transaction, when ctx has a transaction already (see runInTx), events are appended in it.
+func (s *SQLiteEventStore) Append(ctx context.Context, streamID string, expectedVersion int64, events ...StoredEvent) error {
+	return runInTx(ctx, s.db, func(ctx context.Context) error {
+		tx, _ := txFromContext(ctx)
+
+		var version int64
+		if err := tx.QueryRowContext(
+			ctx,
+			`SELECT COALESCE(MAX(version), 0) FROM events WHERE stream_id = ?`,
+			streamID,
+		).Scan(&version); err != nil {
+			return errors.Wrap(err, "cannot read stream version")
+		}
+
+		if expectedVersion != AnyVersion && version != expectedVersion {
+			return errors.Wrapf(ErrConcurrencyConflict, "stream %s is at version %d, expected %d", streamID, version, expectedVersion)
+		}
+
+		for _, event := range events {
+			version++
+
+			metadata, err := json.Marshal(event.Metadata)
+			if err != nil {
+				return errors.Wrap(err, "cannot marshal metadata")
+			}
+
+			recordedAt := event.RecordedAt
+			if recordedAt.IsZero() {
+				recordedAt = time.Now().UTC()
+			}
+
+			if _, err := tx.ExecContext(
+				ctx,
+				`INSERT INTO events (stream_id, version, uuid, name, payload, metadata, recorded_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				streamID, version, event.UUID, event.Name, event.Payload, string(metadata), recordedAt,
+			); err != nil {
+				return errors.Wrapf(err, "cannot insert event %s", event.UUID)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *SQLiteEventStore) LoadStream(ctx context.Context, streamID string, fromVersion int64) ([]StoredEvent, error) {
+	return s.query(
+		ctx,
+		`SELECT position, stream_id, version, uuid, name, payload, metadata, recorded_at
+		FROM events WHERE stream_id = ? AND version > ? ORDER BY version`,
+		streamID, fromVersion,
+	)
+}
+
+func (s *SQLiteEventStore) LoadAll(ctx context.Context, fromPosition int64, limit int) ([]StoredEvent, error) {
+	return s.query(
+		ctx,
+		`SELECT position, stream_id, version, uuid, name, payload, metadata, recorded_at
+		FROM events WHERE position > ? ORDER BY position LIMIT ?`,
+		fromPosition, limit,
+	)
+}
+
+func (s *SQLiteEventStore) LoadStreams(ctx context.Context, streamPrefix string, fromPosition int64, limit int) ([]StoredEvent, error) {
+	// range instead of LIKE, so the index of (stream_id, version) is used,
+	// U+10FFFF is the greatest character, so it's after every stream id with the prefix
+	return s.query(
+		ctx,
+		`SELECT position, stream_id, version, uuid, name, payload, metadata, recorded_at
+		FROM events WHERE stream_id >= ? AND stream_id < ? AND position > ? ORDER BY position LIMIT ?`,
+		streamPrefix, streamPrefix+"\U0010FFFF", fromPosition, limit,
+	)
+}
+
+func (s *SQLiteEventStore) query(ctx context.Context, query string, args ...interface{}) ([]StoredEvent, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot query events")
+	}
+	defer rows.Close()
+
+	var events []StoredEvent
+	for rows.Next() {
+		var event StoredEvent
+		var metadata string
+
+		if err := rows.Scan(
+			&event.Position,
+			&event.StreamID,
+			&event.Version,
+			&event.UUID,
+			&event.Name,
+			&event.Payload,
+			&metadata,
+			&event.RecordedAt,
+		); err != nil {
+			return nil, errors.Wrap(err, "cannot scan event")
+		}
+
+		if err := json.Unmarshal([]byte(metadata), &event.Metadata); err != nil {
+			return nil, errors.Wrapf(err, "cannot unmarshal metadata of event %d", event.Position)
+		}
+
+		events = append(events, event)
+	}
+
+	return events, errors.Wrap(rows.Err(), "cannot iterate events")
+}
+
+// decodeStoredEvent unmarshals stored event into one of the given event types.
+// When the event is not of any of these types, false is returned.
+func decodeStoredEvent(
+	marshaler cqrs.CommandEventMarshaler,
+	storedEvent StoredEvent,
+	eventTypes []proto.Message,
+) (proto.Message, bool, error) {
+	for _, eventType := range eventTypes {
+		if marshaler.Name(eventType) != storedEvent.Name {
+			continue
+		}
+
+		event := eventType.ProtoReflect().New().Interface()
+		if err := marshaler.Unmarshal(message.NewMessage(storedEvent.UUID, storedEvent.Payload), event); err != nil {
+			return nil, false, errors.Wrapf(err, "cannot unmarshal event %s", storedEvent.UUID)
+		}
+
+		return event, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// replayBatchSize is the number of events loaded from the event store at once when replaying all events.
+const replayBatchSize = 500
+
+// replayEvents calls apply for every stored event of the given types from streams with id starting with streamPrefix,
+// in the order in which they were stored.
+func replayEvents(
+	ctx context.Context,
+	eventStore EventStore,
+	marshaler cqrs.CommandEventMarshaler,
+	streamPrefix string,
+	eventTypes []proto.Message,
+	apply func(event proto.Message),
+) error {
+	var position int64
+	for {
+		storedEvents, err := eventStore.LoadStreams(ctx, streamPrefix, position, replayBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(storedEvents) == 0 {
+			return nil
+		}
+
+		for _, storedEvent := range storedEvents {
+			position = storedEvent.Position
+
+			event, ok, err := decodeStoredEvent(marshaler, storedEvent, eventTypes)
+			if err != nil {
+				return err
+			}
+			if ok {
+				apply(event)
+			}
+		}
+	}
+}
+
+type eventStreamCtxKey struct{}
+
+type eventStream struct {
+	streamID        string
+	expectedVersion int64
+}
+
+// WithEventStream sets the stream to which events published with this context are appended.
+// It should be used with context passed to cqrs.EventBus.Publish.
+func WithEventStream(ctx context.Context, streamID string, expectedVersion int64) context.Context {
+	return context.WithValue(ctx, eventStreamCtxKey{}, eventStream{streamID, expectedVersion})
+}
+
+// EventStorePublisher is message.Publisher, which appends every event to EventStore
+// and stores it in Outbox in the same transaction.
+// Events are sent to the message broker later by OutboxRelay, so they can't be lost when publishing fails.
+//
+// Stream of the event is taken from the message context (see WithEventStream).
+// Events published without a stream are appended to the stream named after the event, without concurrency check.
+// When the message context has a transaction (see runInTx), the event is stored in it.
+type EventStorePublisher struct {
+	db     *sql.DB
+	store  EventStore
+	outbox *Outbox
+}
+
+func NewEventStorePublisher(db *sql.DB, store EventStore, outbox *Outbox) EventStorePublisher {
+	return EventStorePublisher{db, store, outbox}
+}
+
+func (p EventStorePublisher) Publish(topic string, messages ...*message.Message) error {
+	for _, msg := range messages {
+		msg := msg
+
+		err := runInTx(msg.Context(), p.db, func(ctx context.Context) error {
+			stream, ok := ctx.Value(eventStreamCtxKey{}).(eventStream)
+			if !ok {
+				stream = eventStream{streamID: msg.Metadata.Get("name"), expectedVersion: AnyVersion}
+			}
+
+			if err := p.store.Append(ctx, stream.streamID, stream.expectedVersion, StoredEvent{
+				UUID:     msg.UUID,
+				Name:     msg.Metadata.Get("name"),
+				Payload:  msg.Payload,
+				Metadata: msg.Metadata,
+			}); err != nil {
+				return err
+			}
+
+			return p.outbox.Add(ctx, topic, msg)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "cannot store event %s", msg.UUID)
+		}
+	}
+
+	return nil
+}
+
+func (p EventStorePublisher) Close() error {
+	return nil
+}
@@ -0,0 +1,393 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.19.4
+// source: inputs/events.proto
+
+package events
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// HotelServiceClient is the client API for HotelService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type HotelServiceClient interface {
+	BookRoom(ctx context.Context, in *BookRoomRequest, opts ...grpc.CallOption) (*BookRoomResponse, error)
+	CancelBooking(ctx context.Context, in *CancelBookingRequest, opts ...grpc.CallOption) (*CommandResponse, error)
+	ModifyBooking(ctx context.Context, in *ModifyBookingRequest, opts ...grpc.CallOption) (*CommandResponse, error)
+	OrderBeer(ctx context.Context, in *OrderBeerRequest, opts ...grpc.CallOption) (*CommandResponse, error)
+	RestockBeer(ctx context.Context, in *RestockBeerRequest, opts ...grpc.CallOption) (*CommandResponse, error)
+	CheckIn(ctx context.Context, in *CheckInRequest, opts ...grpc.CallOption) (*CommandResponse, error)
+	CheckOut(ctx context.Context, in *CheckOutRequest, opts ...grpc.CallOption) (*CommandResponse, error)
+	GetReservation(ctx context.Context, in *GetReservationRequest, opts ...grpc.CallOption) (*Reservation, error)
+	GetFinancialReport(ctx context.Context, in *GetFinancialReportRequest, opts ...grpc.CallOption) (*FinancialReport, error)
+}
+
+type hotelServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewHotelServiceClient(cc grpc.ClientConnInterface) HotelServiceClient {
+	return &hotelServiceClient{cc}
+}
+
+func (c *hotelServiceClient) BookRoom(ctx context.Context, in *BookRoomRequest, opts ...grpc.CallOption) (*BookRoomResponse, error) {
+	out := new(BookRoomResponse)
+	err := c.cc.Invoke(ctx, "/main.HotelService/BookRoom", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hotelServiceClient) CancelBooking(ctx context.Context, in *CancelBookingRequest, opts ...grpc.CallOption) (*CommandResponse, error) {
+	out := new(CommandResponse)
+	err := c.cc.Invoke(ctx, "/main.HotelService/CancelBooking", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hotelServiceClient) ModifyBooking(ctx context.Context, in *ModifyBookingRequest, opts ...grpc.CallOption) (*CommandResponse, error) {
+	out := new(CommandResponse)
+	err := c.cc.Invoke(ctx, "/main.HotelService/ModifyBooking", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hotelServiceClient) OrderBeer(ctx context.Context, in *OrderBeerRequest, opts ...grpc.CallOption) (*CommandResponse, error) {
+	out := new(CommandResponse)
+	err := c.cc.Invoke(ctx, "/main.HotelService/OrderBeer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hotelServiceClient) RestockBeer(ctx context.Context, in *RestockBeerRequest, opts ...grpc.CallOption) (*CommandResponse, error) {
+	out := new(CommandResponse)
+	err := c.cc.Invoke(ctx, "/main.HotelService/RestockBeer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hotelServiceClient) CheckIn(ctx context.Context, in *CheckInRequest, opts ...grpc.CallOption) (*CommandResponse, error) {
+	out := new(CommandResponse)
+	err := c.cc.Invoke(ctx, "/main.HotelService/CheckIn", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hotelServiceClient) CheckOut(ctx context.Context, in *CheckOutRequest, opts ...grpc.CallOption) (*CommandResponse, error) {
+	out := new(CommandResponse)
+	err := c.cc.Invoke(ctx, "/main.HotelService/CheckOut", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hotelServiceClient) GetReservation(ctx context.Context, in *GetReservationRequest, opts ...grpc.CallOption) (*Reservation, error) {
+	out := new(Reservation)
+	err := c.cc.Invoke(ctx, "/main.HotelService/GetReservation", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hotelServiceClient) GetFinancialReport(ctx context.Context, in *GetFinancialReportRequest, opts ...grpc.CallOption) (*FinancialReport, error) {
+	out := new(FinancialReport)
+	err := c.cc.Invoke(ctx, "/main.HotelService/GetFinancialReport", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// HotelServiceServer is the server API for HotelService service.
+// All implementations must embed UnimplementedHotelServiceServer
+// for forward compatibility
+type HotelServiceServer interface {
+	BookRoom(context.Context, *BookRoomRequest) (*BookRoomResponse, error)
+	CancelBooking(context.Context, *CancelBookingRequest) (*CommandResponse, error)
+	ModifyBooking(context.Context, *ModifyBookingRequest) (*CommandResponse, error)
+	OrderBeer(context.Context, *OrderBeerRequest) (*CommandResponse, error)
+	RestockBeer(context.Context, *RestockBeerRequest) (*CommandResponse, error)
+	CheckIn(context.Context, *CheckInRequest) (*CommandResponse, error)
+	CheckOut(context.Context, *CheckOutRequest) (*CommandResponse, error)
+	GetReservation(context.Context, *GetReservationRequest) (*Reservation, error)
+	GetFinancialReport(context.Context, *GetFinancialReportRequest) (*FinancialReport, error)
+	mustEmbedUnimplementedHotelServiceServer()
+}
+
+// UnimplementedHotelServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedHotelServiceServer struct {
+}
+
+func (UnimplementedHotelServiceServer) BookRoom(context.Context, *BookRoomRequest) (*BookRoomResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BookRoom not implemented")
+}
+func (UnimplementedHotelServiceServer) CancelBooking(context.Context, *CancelBookingRequest) (*CommandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelBooking not implemented")
+}
+func (UnimplementedHotelServiceServer) ModifyBooking(context.Context, *ModifyBookingRequest) (*CommandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ModifyBooking not implemented")
+}
+func (UnimplementedHotelServiceServer) OrderBeer(context.Context, *OrderBeerRequest) (*CommandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OrderBeer not implemented")
+}
+func (UnimplementedHotelServiceServer) RestockBeer(context.Context, *RestockBeerRequest) (*CommandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestockBeer not implemented")
+}
+func (UnimplementedHotelServiceServer) CheckIn(context.Context, *CheckInRequest) (*CommandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckIn not implemented")
+}
+func (UnimplementedHotelServiceServer) CheckOut(context.Context, *CheckOutRequest) (*CommandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckOut not implemented")
+}
+func (UnimplementedHotelServiceServer) GetReservation(context.Context, *GetReservationRequest) (*Reservation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetReservation not implemented")
+}
+func (UnimplementedHotelServiceServer) GetFinancialReport(context.Context, *GetFinancialReportRequest) (*FinancialReport, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFinancialReport not implemented")
+}
+func (UnimplementedHotelServiceServer) mustEmbedUnimplementedHotelServiceServer() {}
+
+// UnsafeHotelServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to HotelServiceServer will
+// result in compilation errors.
+type UnsafeHotelServiceServer interface {
+	mustEmbedUnimplementedHotelServiceServer()
+}
+
+func RegisterHotelServiceServer(s grpc.ServiceRegistrar, srv HotelServiceServer) {
+	s.RegisterService(&HotelService_ServiceDesc, srv)
+}
+
+func _HotelService_BookRoom_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BookRoomRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HotelServiceServer).BookRoom(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/main.HotelService/BookRoom",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HotelServiceServer).BookRoom(ctx, req.(*BookRoomRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HotelService_CancelBooking_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelBookingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HotelServiceServer).CancelBooking(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/main.HotelService/CancelBooking",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HotelServiceServer).CancelBooking(ctx, req.(*CancelBookingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HotelService_ModifyBooking_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModifyBookingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HotelServiceServer).ModifyBooking(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/main.HotelService/ModifyBooking",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HotelServiceServer).ModifyBooking(ctx, req.(*ModifyBookingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HotelService_OrderBeer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OrderBeerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HotelServiceServer).OrderBeer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/main.HotelService/OrderBeer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HotelServiceServer).OrderBeer(ctx, req.(*OrderBeerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HotelService_RestockBeer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestockBeerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HotelServiceServer).RestockBeer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/main.HotelService/RestockBeer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HotelServiceServer).RestockBeer(ctx, req.(*RestockBeerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HotelService_CheckIn_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckInRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HotelServiceServer).CheckIn(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/main.HotelService/CheckIn",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HotelServiceServer).CheckIn(ctx, req.(*CheckInRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HotelService_CheckOut_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckOutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HotelServiceServer).CheckOut(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/main.HotelService/CheckOut",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HotelServiceServer).CheckOut(ctx, req.(*CheckOutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HotelService_GetReservation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetReservationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HotelServiceServer).GetReservation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/main.HotelService/GetReservation",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HotelServiceServer).GetReservation(ctx, req.(*GetReservationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HotelService_GetFinancialReport_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetFinancialReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HotelServiceServer).GetFinancialReport(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/main.HotelService/GetFinancialReport",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HotelServiceServer).GetFinancialReport(ctx, req.(*GetFinancialReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// HotelService_ServiceDesc is the grpc.ServiceDesc for HotelService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var HotelService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "main.HotelService",
+	HandlerType: (*HotelServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "BookRoom",
+			Handler:    _HotelService_BookRoom_Handler,
+		},
+		{
+			MethodName: "CancelBooking",
+			Handler:    _HotelService_CancelBooking_Handler,
+		},
+		{
+			MethodName: "ModifyBooking",
+			Handler:    _HotelService_ModifyBooking_Handler,
+		},
+		{
+			MethodName: "OrderBeer",
+			Handler:    _HotelService_OrderBeer_Handler,
+		},
+		{
+			MethodName: "RestockBeer",
+			Handler:    _HotelService_RestockBeer_Handler,
+		},
+		{
+			MethodName: "CheckIn",
+			Handler:    _HotelService_CheckIn_Handler,
+		},
+		{
+			MethodName: "CheckOut",
+			Handler:    _HotelService_CheckOut_Handler,
+		},
+		{
+			MethodName: "GetReservation",
+			Handler:    _HotelService_GetReservation_Handler,
+		},
+		{
+			MethodName: "GetFinancialReport",
+			Handler:    _HotelService_GetFinancialReport_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "inputs/events.proto",
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"log"
+	"main.go/events"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// financialReportProjection is the name under which BookingsFinancialReport is saved in ProjectionStore.
+	financialReportProjection = "bookings_financial_report"
+	// financialReportAppliedEventsProjection has keys of events applied to the report as items (see financialReportEventKey).
+	financialReportAppliedEventsProjection = "bookings_financial_report_applied_events"
+)
+
+// BookingsFinancialReport is a read model, which calculates how much money we may earn from bookings.
+// It listens for RoomBooked event, price deltas of modified bookings are added to the total charge,
+// and refunds and credits are subtracted from it.
+//
+// The state is saved in ProjectionStore after every event, so the report survives restarts.
+// Events are deduplicated by financialReportEventKey, the key is saved as an item of a separate projection
+// atomically with the state, so a crash can't count the event twice.
+// When it goes wrong, it can be rebuilt from the event store with RebuildBookingsFinancialReport.
+type BookingsFinancialReport struct {
+	state financialReportState
+	store ProjectionStore
+	lock  sync.Mutex
+}
+
+// financialReportState is the state of BookingsFinancialReport saved in ProjectionStore.
+type financialReportState struct {
+	Bookings      int   `json:"bookings"`
+	Modifications int   `json:"modifications"`
+	Cancellations int   `json:"cancellations"`
+	TotalCharge   int64 `json:"total_charge"`
+	Credits       int64 `json:"credits"`
+}
+
+// financialReportEvents are all events which are changing BookingsFinancialReport.
+var financialReportEvents = []proto.Message{
+	&events.RoomBooked{},
+	&events.BookingModified{},
+	&events.BookingCancelled{},
+	&events.CreditApplied{},
+}
+
+// apply changes the state according to the event, it doesn't check if the event was already applied.
+func (s *financialReportState) apply(event proto.Message) {
+	switch e := event.(type) {
+	case *events.RoomBooked:
+		s.Bookings++
+		s.TotalCharge += e.Price
+	case *events.BookingModified:
+		s.Modifications++
+		s.TotalCharge += e.PriceDelta
+	case *events.BookingCancelled:
+		s.Cancellations++
+		s.TotalCharge -= e.RefundAmount
+	case *events.CreditApplied:
+		s.Credits += e.Amount
+		s.TotalCharge -= e.Amount
+	}
+}
+
+// financialReportEventKey returns id of the reservation, so every booking and cancellation is counted once,
+// even when the event is published more than once. Reservation may have more modifications
+// and credits, so they are counted once by their ids.
+func financialReportEventKey(event proto.Message) string {
+	switch e := event.(type) {
+	case *events.RoomBooked:
+		return "booking-" + e.ReservationId
+	case *events.BookingModified:
+		return "modification-" + e.ModificationId
+	case *events.BookingCancelled:
+		return "cancellation-" + e.ReservationId
+	case *events.CreditApplied:
+		return "credit-" + e.CreditId
+	default:
+		return ""
+	}
+}
+
+// NewBookingsFinancialReport creates the report with the state loaded from the store.
+func NewBookingsFinancialReport(ctx context.Context, store ProjectionStore) (*BookingsFinancialReport, error) {
+	var state financialReportState
+	if _, err := store.Load(ctx, financialReportProjection, &state); err != nil {
+		return nil, err
+	}
+
+	return &BookingsFinancialReport{state: state, store: store}, nil
+}
+
+func (b *BookingsFinancialReport) HandlerName() string {
+	return "BookingsFinancialReport"
+}
+
+func (*BookingsFinancialReport) NewEvent() interface{} {
+	return &events.RoomBooked{}
+}
+
+func (b *BookingsFinancialReport) Handle(ctx context.Context, e interface{}) error {
+	return b.handle(ctx, e.(proto.Message))
+}
+
+// CreditAppliedHandler subtracts credits of guests from the report.
+func (b *BookingsFinancialReport) CreditAppliedHandler() cqrs.EventHandler {
+	return eventHandler{
+		name:     "BookingsFinancialReportOnCreditApplied",
+		newEvent: func() interface{} { return &events.CreditApplied{} },
+		handle: func(ctx context.Context, e interface{}) error {
+			return b.handle(ctx, e.(proto.Message))
+		},
+	}
+}
+
+// BookingModifiedHandler adds the price delta of modified bookings to the report.
+func (b *BookingsFinancialReport) BookingModifiedHandler() cqrs.EventHandler {
+	return eventHandler{
+		name:     "BookingsFinancialReportOnBookingModified",
+		newEvent: func() interface{} { return &events.BookingModified{} },
+		handle: func(ctx context.Context, e interface{}) error {
+			return b.handle(ctx, e.(proto.Message))
+		},
+	}
+}
+
+// BookingCancelledHandler subtracts refunds of cancelled bookings from the report.
+func (b *BookingsFinancialReport) BookingCancelledHandler() cqrs.EventHandler {
+	return eventHandler{
+		name:     "BookingsFinancialReportOnBookingCancelled",
+		newEvent: func() interface{} { return &events.BookingCancelled{} },
+		handle: func(ctx context.Context, e interface{}) error {
+			return b.handle(ctx, e.(proto.Message))
+		},
+	}
+}
+
+func (b *BookingsFinancialReport) handle(ctx context.Context, event proto.Message) error {
+	// Handle may be called concurrently, so it need to be thread safe.
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	key := financialReportEventKey(event)
+	if key == "" {
+		return nil
+	}
+
+	applied, err := b.store.HasItem(ctx, financialReportAppliedEventsProjection, key)
+	if err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+
+	b.state.apply(event)
+
+	// applied key is saved with the state, so the event is never counted twice, even after crash
+	if err := b.store.SaveWithItem(ctx, financialReportProjection, b.state, financialReportAppliedEventsProjection, key, true); err != nil {
+		// event will be redelivered, so the state in memory must go back to what was saved
+		b.reload(ctx)
+		return err
+	}
+
+	logf(ctx, "Already booked rooms for $%d", b.state.TotalCharge)
+	return nil
+}
+
+func (b *BookingsFinancialReport) reload(ctx context.Context) {
+	var state financialReportState
+	if _, err := b.store.Load(ctx, financialReportProjection, &state); err != nil {
+		log.Printf("Cannot reload financial report: %s", err)
+		return
+	}
+
+	b.state = state
+}
+
+// FinancialReportView is BookingsFinancialReport as it is presented by the query API.
+type FinancialReportView struct {
+	TotalCharge   int64 `json:"total_charge"`
+	Bookings      int   `json:"bookings"`
+	Modifications int   `json:"modifications"`
+	Cancellations int   `json:"cancellations"`
+	Credits       int64 `json:"credits"`
+}
+
+// View returns current state of the report.
+func (b *BookingsFinancialReport) View() FinancialReportView {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return FinancialReportView{
+		TotalCharge:   b.state.TotalCharge,
+		Bookings:      b.state.Bookings,
+		Modifications: b.state.Modifications,
+		Cancellations: b.state.Cancellations,
+		Credits:       b.state.Credits,
+	}
+}
+
+// RebuildBookingsFinancialReport recreates BookingsFinancialReport from scratch by replaying all events from the event store.
+//
+// Saved state of the report is replaced, so it should be called when the service is not running.
+func RebuildBookingsFinancialReport(
+	ctx context.Context,
+	eventStore EventStore,
+	store ProjectionStore,
+	marshaler cqrs.CommandEventMarshaler,
+) (int64, error) {
+	var state financialReportState
+	applied := map[string]bool{}
+
+	// every reservation has one stream in the event store, so its events are not duplicated there
+	if err := replayEvents(ctx, eventStore, marshaler, reservationStreamPrefix, financialReportEvents, func(event proto.Message) {
+		key := financialReportEventKey(event)
+		if key == "" || applied[key] {
+			return
+		}
+
+		state.apply(event)
+		applied[key] = true
+	}); err != nil {
+		return 0, err
+	}
+
+	// when saving fails, the rebuild can be simply run again
+	for key := range applied {
+		if err := store.SaveItem(ctx, financialReportAppliedEventsProjection, key, true); err != nil {
+			return 0, errors.Wrap(err, "cannot save applied events of rebuilt financial report")
+		}
+	}
+	if err := store.Save(ctx, financialReportProjection, state); err != nil {
+		return 0, errors.Wrap(err, "cannot save rebuilt financial report")
+	}
+
+	return state.TotalCharge, nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"main.go/events"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GRPCServer implements events.HotelServiceServer in front of the command bus and read models.
+// Requests are validated the same way as in HTTP API.
+type GRPCServer struct {
+	events.UnimplementedHotelServiceServer
+
+	commandBus      *cqrs.CommandBus
+	bookingOutcomes *BookingOutcomes
+	financialReport *BookingsFinancialReport
+	reservations    *ReservationsReadModel
+}
+
+func NewGRPCServer(
+	commandBus *cqrs.CommandBus,
+	bookingOutcomes *BookingOutcomes,
+	financialReport *BookingsFinancialReport,
+	reservations *ReservationsReadModel,
+) *GRPCServer {
+	return &GRPCServer{
+		commandBus:      commandBus,
+		bookingOutcomes: bookingOutcomes,
+		financialReport: financialReport,
+		reservations:    reservations,
+	}
+}
+
+func (s *GRPCServer) BookRoom(ctx context.Context, req *events.BookRoomRequest) (*events.BookRoomResponse, error) {
+	if errs := (bookRoomRequest{
+		RoomID:    req.RoomId,
+		GuestName: req.GuestName,
+		StartDate: timeOrZero(req.StartDate),
+		EndDate:   timeOrZero(req.EndDate),
+	}).validate(); len(errs) > 0 {
+		return nil, invalidArgument(errs)
+	}
+
+	result, err := sendBookRoom(ctx, s.commandBus, s.bookingOutcomes, &events.BookRoom{
+		RoomId:    req.RoomId,
+		GuestName: req.GuestName,
+		StartDate: req.StartDate,
+		EndDate:   req.EndDate,
+		PromoCode: req.PromoCode,
+	}, req.Wait)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "cannot send command")
+	}
+
+	resp := &events.BookRoomResponse{
+		CommandId:     result.CommandID,
+		ReservationId: result.ReservationID,
+		Status:        events.BookingStatus_BOOKING_STATUS_PENDING,
+	}
+
+	if result.Outcome != nil {
+		if result.Outcome.Booked {
+			resp.Status = events.BookingStatus_BOOKING_STATUS_BOOKED
+		} else {
+			resp.Status = events.BookingStatus_BOOKING_STATUS_REJECTED
+			resp.RejectionReason = result.Outcome.RejectionReason
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *GRPCServer) CancelBooking(ctx context.Context, req *events.CancelBookingRequest) (*events.CommandResponse, error) {
+	if strings.TrimSpace(req.ReservationId) == "" {
+		return nil, invalidArgument([]string{"reservation_id is required"})
+	}
+
+	return s.sendCommand(ctx, &events.CancelBooking{ReservationId: req.ReservationId})
+}
+
+func (s *GRPCServer) ModifyBooking(ctx context.Context, req *events.ModifyBookingRequest) (*events.CommandResponse, error) {
+	r := modifyBookingRequest{
+		ReservationID: req.ReservationId,
+		RoomID:        req.RoomId,
+		StartDate:     timeOrZero(req.StartDate),
+		EndDate:       timeOrZero(req.EndDate),
+	}
+	if errs := r.validate(); len(errs) > 0 {
+		return nil, invalidArgument(errs)
+	}
+
+	return s.sendCommand(ctx, r.command())
+}
+
+func (s *GRPCServer) CheckIn(ctx context.Context, req *events.CheckInRequest) (*events.CommandResponse, error) {
+	if errs := (reservationCommandRequest{ReservationID: req.ReservationId}).validate(); len(errs) > 0 {
+		return nil, invalidArgument(errs)
+	}
+
+	return s.sendCommand(ctx, &events.CheckIn{ReservationId: req.ReservationId})
+}
+
+func (s *GRPCServer) CheckOut(ctx context.Context, req *events.CheckOutRequest) (*events.CommandResponse, error) {
+	if errs := (reservationCommandRequest{ReservationID: req.ReservationId}).validate(); len(errs) > 0 {
+		return nil, invalidArgument(errs)
+	}
+
+	return s.sendCommand(ctx, &events.CheckOut{ReservationId: req.ReservationId})
+}
+
+func (s *GRPCServer) OrderBeer(ctx context.Context, req *events.OrderBeerRequest) (*events.CommandResponse, error) {
+	if errs := (orderBeerRequest{RoomID: req.RoomId, Count: req.Count}).validate(); len(errs) > 0 {
+		return nil, invalidArgument(errs)
+	}
+
+	return s.sendCommand(ctx, &events.OrderBeer{RoomId: req.RoomId, Count: req.Count, BeerType: req.BeerType})
+}
+
+func (s *GRPCServer) RestockBeer(ctx context.Context, req *events.RestockBeerRequest) (*events.CommandResponse, error) {
+	if errs := (restockBeerRequest{BeerType: req.BeerType, Count: req.Count}).validate(); len(errs) > 0 {
+		return nil, invalidArgument(errs)
+	}
+
+	return s.sendCommand(ctx, &events.RestockBeer{BeerType: req.BeerType, Count: req.Count})
+}
+
+func (s *GRPCServer) sendCommand(ctx context.Context, cmd interface{}) (*events.CommandResponse, error) {
+	commandID := watermill.NewUUID()
+
+	if err := s.commandBus.Send(WithMessageUUID(ctx, commandID), cmd); err != nil {
+		return nil, status.Error(codes.Internal, "cannot send command")
+	}
+
+	return &events.CommandResponse{CommandId: commandID}, nil
+}
+
+func (s *GRPCServer) GetReservation(ctx context.Context, req *events.GetReservationRequest) (*events.Reservation, error) {
+	reservation, ok := s.reservations.Reservation(req.ReservationId)
+	if !ok {
+		return nil, status.Error(codes.NotFound, "reservation not found")
+	}
+
+	resp := &events.Reservation{
+		Id:           reservation.ID,
+		RoomId:       reservation.RoomID,
+		GuestName:    reservation.GuestName,
+		Price:        reservation.Price,
+		Status:       string(reservation.Status),
+		RefundAmount: reservation.RefundAmount,
+		StartDate:    timestamppb.New(reservation.StartDate),
+		EndDate:      timestamppb.New(reservation.EndDate),
+		Credit:       reservation.Credit,
+	}
+	if reservation.CheckedInAt != nil {
+		resp.CheckedInAt = timestamppb.New(*reservation.CheckedInAt)
+	}
+	if reservation.CheckedOutAt != nil {
+		resp.CheckedOutAt = timestamppb.New(*reservation.CheckedOutAt)
+	}
+
+	return resp, nil
+}
+
+func (s *GRPCServer) GetFinancialReport(ctx context.Context, req *events.GetFinancialReportRequest) (*events.FinancialReport, error) {
+	report := s.financialReport.View()
+
+	return &events.FinancialReport{
+		TotalCharge:   report.TotalCharge,
+		Bookings:      int64(report.Bookings),
+		Cancellations: int64(report.Cancellations),
+		Credits:       report.Credits,
+		Modifications: int64(report.Modifications),
+	}, nil
+}
+
+// stopGRPCServer waits until RPCs in progress are finished, they are cancelled when ctx is done.
+func stopGRPCServer(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
+
+func invalidArgument(errs []string) error {
+	return status.Error(codes.InvalidArgument, strings.Join(errs, ", "))
+}
+
+// timeOrZero returns zero time for missing timestamp, so it's reported as missing by validation.
+func timeOrZero(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+
+	return ts.AsTime()
+}
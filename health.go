@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// healthCheckTimeout limits how long all readiness checks can take, so a hanging dependency doesn't block the probe.
+const healthCheckTimeout = 5 * time.Second
+
+// RouterState is the state of the message router reported by health checks.
+type RouterState int32
+
+const (
+	RouterStarting RouterState = iota
+	RouterRunning
+	RouterStopping
+	RouterStopped
+)
+
+var routerStateNames = map[RouterState]string{
+	RouterStarting: "starting",
+	RouterRunning:  "running",
+	RouterStopping: "stopping",
+	RouterStopped:  "stopped",
+}
+
+func (s RouterState) String() string {
+	return routerStateNames[s]
+}
+
+// HealthCheck checks a dependency of the service, details are shown in the response also when the check fails.
+type HealthCheck func(ctx context.Context) (details interface{}, err error)
+
+// Health serves liveness (/healthz) and readiness (/readyz) of the service.
+//
+// The service is live until the router stops, because it can't handle any message after that.
+// It's ready when it can process commands: the router is running and all checks succeed.
+type Health struct {
+	routerState int32
+	checks      []namedHealthCheck
+}
+
+type namedHealthCheck struct {
+	name  string
+	check HealthCheck
+}
+
+func NewHealth() *Health {
+	return &Health{}
+}
+
+// SetRouterState changes the state of the router, the state can only move forward (starting → running → stopping → stopped).
+func (h *Health) SetRouterState(state RouterState) {
+	for {
+		current := atomic.LoadInt32(&h.routerState)
+		if RouterState(current) >= state || atomic.CompareAndSwapInt32(&h.routerState, current, int32(state)) {
+			return
+		}
+	}
+}
+
+func (h *Health) RouterState() RouterState {
+	return RouterState(atomic.LoadInt32(&h.routerState))
+}
+
+// AddCheck adds check to the readiness, it must be called before the HTTP API is started.
+func (h *Health) AddCheck(name string, check HealthCheck) {
+	h.checks = append(h.checks, namedHealthCheck{name, check})
+}
+
+type healthResponse struct {
+	Status string                       `json:"status"`
+	Router string                       `json:"router"`
+	Checks map[string]healthCheckResult `json:"checks,omitempty"`
+}
+
+type healthCheckResult struct {
+	Status  string      `json:"status"`
+	Error   string      `json:"error,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// LivenessHandler responds with 503 when the router stopped, so the service should be restarted.
+func (h *Health) LivenessHandler() http.Handler {
+	return onlyMethod(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		state := h.RouterState()
+
+		if state == RouterStopped {
+			writeJSON(w, http.StatusServiceUnavailable, healthResponse{Status: "unavailable", Router: state.String()})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, healthResponse{Status: "ok", Router: state.String()})
+	})
+}
+
+// ReadinessHandler runs all checks and responds with 503 when the router isn't running or any check fails.
+func (h *Health) ReadinessHandler() http.Handler {
+	return onlyMethod(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		state := h.RouterState()
+		response := healthResponse{Status: "ok", Router: state.String(), Checks: map[string]healthCheckResult{}}
+		if state != RouterRunning {
+			response.Status = "unavailable"
+		}
+
+		for _, c := range h.checks {
+			details, err := c.check(ctx)
+
+			result := healthCheckResult{Status: "ok", Details: details}
+			if err != nil {
+				result.Status = "failed"
+				result.Error = err.Error()
+				response.Status = "unavailable"
+			}
+			response.Checks[c.name] = result
+		}
+
+		status := http.StatusOK
+		if response.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, response)
+	})
+}
+
+// DatabaseCheck checks connection to the SQLite database with events.
+func DatabaseCheck(db *sql.DB) HealthCheck {
+	return func(ctx context.Context) (interface{}, error) {
+		return nil, errors.Wrap(db.PingContext(ctx), "cannot connect to database")
+	}
+}
+
+// TransportCheck checks connection to the broker and reports consumer lag, when the transport knows it.
+func TransportCheck(transport Transport) HealthCheck {
+	return func(ctx context.Context) (interface{}, error) {
+		return transport.Check(ctx)
+	}
+}
+
+// ReadModelFreshness tracks when read models were updated, and how long events are waiting for them.
+//
+// Read models are updated asynchronously, they are stale when events wait in the outbox for longer than maxLag
+// (for example when the broker is not reachable).
+type ReadModelFreshness struct {
+	outbox *Outbox
+	maxLag time.Duration
+
+	// handledEvents are names of events handled by each read model handler, it's filled by Track
+	handledEvents map[string]string
+
+	lastUpdates map[string]time.Time
+	lock        sync.Mutex
+}
+
+func NewReadModelFreshness(outbox *Outbox, maxLag time.Duration) *ReadModelFreshness {
+	return &ReadModelFreshness{
+		outbox:        outbox,
+		maxLag:        maxLag,
+		handledEvents: map[string]string{},
+		lastUpdates:   map[string]time.Time{},
+	}
+}
+
+// Track adds event handlers of read models, it must be called before the router is started.
+func (f *ReadModelFreshness) Track(marshaler cqrs.CommandEventMarshaler, handlers ...cqrs.EventHandler) {
+	for _, h := range handlers {
+		f.handledEvents[h.HandlerName()] = marshaler.Name(h.NewEvent())
+	}
+}
+
+// Middleware is router middleware recording when the event was applied to the read model.
+func (f *ReadModelFreshness) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		handlerName := message.HandlerNameFromCtx(msg.Context())
+
+		produced, err := h(msg)
+
+		// event handlers receive all events, but only the handled ones are updating the read model
+		if eventName, ok := f.handledEvents[handlerName]; ok && err == nil && eventName == msg.Metadata.Get("name") {
+			f.lock.Lock()
+			f.lastUpdates[handlerName] = time.Now().UTC()
+			f.lock.Unlock()
+		}
+
+		return produced, err
+	}
+}
+
+type readModelFreshnessDetails struct {
+	// PendingEvents is the number of events in the outbox, which didn't reach the read models yet.
+	PendingEvents int `json:"pending_events"`
+	// Lag is how long the oldest pending event waits.
+	Lag string `json:"lag"`
+	// LastUpdates are times of the last event applied by each read model handler since the start.
+	LastUpdates map[string]time.Time `json:"last_updates"`
+}
+
+// Check fails when the oldest event in the outbox is older than maxLag.
+func (f *ReadModelFreshness) Check(ctx context.Context) (interface{}, error) {
+	pending, oldest, err := f.outbox.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var lag time.Duration
+	if pending > 0 {
+		lag = time.Since(oldest)
+	}
+
+	details := readModelFreshnessDetails{
+		PendingEvents: pending,
+		Lag:           lag.Round(time.Millisecond).String(),
+		LastUpdates:   map[string]time.Time{},
+	}
+	f.lock.Lock()
+	for handlerName, updated := range f.lastUpdates {
+		details.LastUpdates[handlerName] = updated
+	}
+	f.lock.Unlock()
+
+	if lag > f.maxLag {
+		return details, errors.Errorf("read models are stale, events wait in the outbox for %s", details.Lag)
+	}
+
+	return details, nil
+}
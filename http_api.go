@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// HTTPAPI exposes read models and sends commands over HTTP, requests and responses are JSON.
+type HTTPAPI struct {
+	commandBus      *cqrs.CommandBus
+	bookingOutcomes *BookingOutcomes
+	financialReport *BookingsFinancialReport
+	reservations    *ReservationsReadModel
+	scheduler       *CommandScheduler
+}
+
+func NewHTTPAPI(
+	commandBus *cqrs.CommandBus,
+	bookingOutcomes *BookingOutcomes,
+	financialReport *BookingsFinancialReport,
+	reservations *ReservationsReadModel,
+	scheduler *CommandScheduler,
+) HTTPAPI {
+	return HTTPAPI{
+		commandBus:      commandBus,
+		bookingOutcomes: bookingOutcomes,
+		financialReport: financialReport,
+		reservations:    reservations,
+		scheduler:       scheduler,
+	}
+}
+
+// Handler returns http.Handler with all endpoints:
+//
+//	POST /commands/book-room?wait=true
+//	POST /commands/modify-booking
+//	POST /commands/check-in
+//	POST /commands/check-out
+//	POST /commands/order-beer
+//	POST /commands/restock-beer
+//	POST /commands/schedule
+//	GET /scheduled-commands?status=scheduled
+//	DELETE /scheduled-commands/{id}
+//	GET /reports/financial
+//	GET /reservations?page=1&per_page=20
+//	GET /reservations/{id}
+//	GET /rooms/{id}/bookings?page=1&per_page=20
+func (a HTTPAPI) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/commands/book-room", onlyMethod(http.MethodPost, a.postBookRoom))
+	mux.HandleFunc("/commands/modify-booking", onlyMethod(http.MethodPost, a.postModifyBooking))
+	mux.HandleFunc("/commands/check-in", onlyMethod(http.MethodPost, a.postCheckIn))
+	mux.HandleFunc("/commands/check-out", onlyMethod(http.MethodPost, a.postCheckOut))
+	mux.HandleFunc("/commands/order-beer", onlyMethod(http.MethodPost, a.postOrderBeer))
+	mux.HandleFunc("/commands/restock-beer", onlyMethod(http.MethodPost, a.postRestockBeer))
+	mux.HandleFunc("/commands/schedule", onlyMethod(http.MethodPost, a.postScheduleCommand))
+	mux.HandleFunc("/scheduled-commands", onlyMethod(http.MethodGet, a.getScheduledCommands))
+	mux.HandleFunc("/scheduled-commands/", onlyMethod(http.MethodDelete, a.deleteScheduledCommand))
+
+	mux.HandleFunc("/reports/financial", onlyMethod(http.MethodGet, a.getFinancialReport))
+	mux.HandleFunc("/reservations", onlyMethod(http.MethodGet, a.getReservations))
+	mux.HandleFunc("/reservations/", onlyMethod(http.MethodGet, a.getReservation))
+	mux.HandleFunc("/rooms/", onlyMethod(http.MethodGet, a.getRoomBookings))
+
+	return mux
+}
+
+func (a HTTPAPI) getFinancialReport(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.financialReport.View())
+}
+
+func (a HTTPAPI) getReservations(w http.ResponseWriter, r *http.Request) {
+	writePage(w, r, a.reservations.Reservations())
+}
+
+func (a HTTPAPI) getReservation(w http.ResponseWriter, r *http.Request) {
+	reservationID := strings.TrimPrefix(r.URL.Path, "/reservations/")
+	if reservationID == "" || strings.Contains(reservationID, "/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	reservation, ok := a.reservations.Reservation(reservationID)
+	if !ok {
+		writeError(w, http.StatusNotFound, "reservation not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, reservation)
+}
+
+func (a HTTPAPI) getRoomBookings(w http.ResponseWriter, r *http.Request) {
+	// expected path is /rooms/{id}/bookings
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/rooms/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "bookings" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	writePage(w, r, a.reservations.RoomBookings(parts[0]))
+}
+
+// page is a paginated response of the list endpoints.
+type page struct {
+	Items   []ReservationView `json:"items"`
+	Page    int               `json:"page"`
+	PerPage int               `json:"per_page"`
+	Total   int               `json:"total"`
+}
+
+func writePage(w http.ResponseWriter, r *http.Request, reservations []ReservationView) {
+	pageNumber, err := queryInt(r, "page", 1)
+	if err != nil || pageNumber < 1 {
+		writeError(w, http.StatusBadRequest, "page must be a positive number")
+		return
+	}
+
+	perPage, err := queryInt(r, "per_page", defaultPerPage)
+	if err != nil || perPage < 1 || perPage > maxPerPage {
+		writeError(w, http.StatusBadRequest, "per_page must be a number between 1 and "+strconv.Itoa(maxPerPage))
+		return
+	}
+
+	// pages after the last one are empty, they are checked before multiplying, so a huge page can't overflow
+	from := len(reservations)
+	if pageNumber-1 <= len(reservations)/perPage {
+		from = (pageNumber - 1) * perPage
+	}
+	if from > len(reservations) {
+		from = len(reservations)
+	}
+	to := from + perPage
+	if to > len(reservations) {
+		to = len(reservations)
+	}
+
+	writeJSON(w, http.StatusOK, page{
+		Items:   reservations[from:to],
+		Page:    pageNumber,
+		PerPage: perPage,
+		Total:   len(reservations),
+	})
+}
+
+func queryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+func onlyMethod(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Cannot write response: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWritePage_afterLastPage(t *testing.T) {
+	reservations := []ReservationView{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+
+	for _, pageNumber := range []int{3, 1 << 62, int(^uint(0) >> 1)} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/reservations?per_page=2&page="+strconv.Itoa(pageNumber), nil)
+
+		writePage(w, r, reservations)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200 for page %d, got %d", pageNumber, w.Code)
+		}
+		var resp page
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Items) != 0 || resp.Total != 3 {
+			t.Errorf("expected empty page %d of 3 reservations, got %d items of %d", pageNumber, len(resp.Items), resp.Total)
+		}
+	}
+}
+
+func TestScheduleCommandRequest_parse(t *testing.T) {
+	scheduler := &CommandScheduler{marshaler: ProtobufMarshaler{}}
+	deliverAt := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name    string
+		command string
+		valid   bool
+	}{
+		{name: "OrderBeer", command: `{"room_id": "101", "count": 2}`, valid: true},
+		{name: "OrderBeer", command: `{"room_id": "101", "count": 1000}`},
+		{name: "CheckIn", command: `{}`},
+		{name: "ApplyCredit", command: `{"reservation_id": "1", "amount": 1000}`},
+		{name: "CancelBeerOrder", command: `{"reservation_id": "1", "beer_type": "lager"}`},
+	}
+
+	for _, tc := range testCases {
+		_, errs := scheduleCommandRequest{
+			Name:      tc.name,
+			Command:   json.RawMessage(tc.command),
+			DeliverAt: deliverAt,
+		}.parse(scheduler)
+
+		if tc.valid && len(errs) > 0 {
+			t.Errorf("%s %s should be scheduled, got %v", tc.name, tc.command, errs)
+		}
+		if !tc.valid && len(errs) == 0 {
+			t.Errorf("%s %s should not be scheduled", tc.name, tc.command)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"main.go/events"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const maxBeersInOrder = 100
+
+type bookRoomRequest struct {
+	RoomID    string    `json:"room_id"`
+	GuestName string    `json:"guest_name"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	PromoCode string    `json:"promo_code"`
+}
+
+func (r bookRoomRequest) validate() []string {
+	var errs []string
+
+	if strings.TrimSpace(r.RoomID) == "" {
+		errs = append(errs, "room_id is required")
+	}
+	if strings.TrimSpace(r.GuestName) == "" {
+		errs = append(errs, "guest_name is required")
+	}
+	if r.StartDate.IsZero() {
+		errs = append(errs, "start_date is required")
+	}
+	if r.EndDate.IsZero() {
+		errs = append(errs, "end_date is required")
+	}
+	if !r.StartDate.IsZero() && !r.EndDate.IsZero() && !r.StartDate.Before(r.EndDate) {
+		errs = append(errs, "end_date must be after start_date")
+	}
+	if !r.StartDate.IsZero() && !r.EndDate.IsZero() && stayTooLong(r.StartDate, r.EndDate) {
+		errs = append(errs, ErrStayTooLong.Error())
+	}
+
+	return errs
+}
+
+type bookRoomResponse struct {
+	CommandID     string `json:"command_id"`
+	ReservationID string `json:"reservation_id"`
+	// Status is "pending" when not waiting for the outcome, "booked" or "rejected" otherwise
+	Status          string `json:"status"`
+	RejectionReason string `json:"rejection_reason,omitempty"`
+}
+
+// modifyBookingRequest changes room or dates of the booking, empty fields are not changed.
+// When only one of the dates is changed, length of the stay is checked by Pricing.
+type modifyBookingRequest struct {
+	ReservationID string    `json:"reservation_id"`
+	RoomID        string    `json:"room_id"`
+	StartDate     time.Time `json:"start_date"`
+	EndDate       time.Time `json:"end_date"`
+}
+
+func (r modifyBookingRequest) validate() []string {
+	var errs []string
+
+	if strings.TrimSpace(r.ReservationID) == "" {
+		errs = append(errs, "reservation_id is required")
+	}
+	if strings.TrimSpace(r.RoomID) == "" && r.StartDate.IsZero() && r.EndDate.IsZero() {
+		errs = append(errs, "room_id, start_date or end_date is required")
+	}
+	if !r.StartDate.IsZero() && !r.EndDate.IsZero() && !r.StartDate.Before(r.EndDate) {
+		errs = append(errs, "end_date must be after start_date")
+	}
+	if !r.StartDate.IsZero() && !r.EndDate.IsZero() && stayTooLong(r.StartDate, r.EndDate) {
+		errs = append(errs, ErrStayTooLong.Error())
+	}
+
+	return errs
+}
+
+// command returns ModifyBooking command, zero dates are not sent, so they are not changed.
+func (r modifyBookingRequest) command() *events.ModifyBooking {
+	cmd := &events.ModifyBooking{ReservationId: r.ReservationID, RoomId: r.RoomID}
+	if !r.StartDate.IsZero() {
+		cmd.StartDate = timestamppb.New(r.StartDate)
+	}
+	if !r.EndDate.IsZero() {
+		cmd.EndDate = timestamppb.New(r.EndDate)
+	}
+
+	return cmd
+}
+
+type orderBeerRequest struct {
+	RoomID string `json:"room_id"`
+	Count  int64  `json:"count"`
+	// BeerType is optional, the first beer of the bar is ordered by default
+	BeerType string `json:"beer_type"`
+}
+
+func (r orderBeerRequest) validate() []string {
+	var errs []string
+
+	if strings.TrimSpace(r.RoomID) == "" {
+		errs = append(errs, "room_id is required")
+	}
+	if r.Count < 1 || r.Count > maxBeersInOrder {
+		errs = append(errs, "count must be between 1 and 100")
+	}
+
+	return errs
+}
+
+type restockBeerRequest struct {
+	BeerType string `json:"beer_type"`
+	Count    int64  `json:"count"`
+}
+
+func (r restockBeerRequest) validate() []string {
+	var errs []string
+
+	if strings.TrimSpace(r.BeerType) == "" {
+		errs = append(errs, "beer_type is required")
+	}
+	if r.Count < 1 {
+		errs = append(errs, "count must be positive")
+	}
+
+	return errs
+}
+
+// reservationCommandRequest is the request of commands which are changing the reservation, like check-in.
+type reservationCommandRequest struct {
+	ReservationID string `json:"reservation_id"`
+}
+
+func (r reservationCommandRequest) validate() []string {
+	if strings.TrimSpace(r.ReservationID) == "" {
+		return []string{"reservation_id is required"}
+	}
+
+	return nil
+}
+
+type commandResponse struct {
+	CommandID string `json:"command_id"`
+}
+
+// postBookRoom sends BookRoom command, with ?wait=true it waits until the room is booked or the booking is rejected.
+func (a HTTPAPI) postBookRoom(w http.ResponseWriter, r *http.Request) {
+	var req bookRoomRequest
+	if !readCommandRequest(w, r, &req, func() []string { return req.validate() }) {
+		return
+	}
+
+	result, err := sendBookRoom(r.Context(), a.commandBus, a.bookingOutcomes, &events.BookRoom{
+		RoomId:    req.RoomID,
+		GuestName: req.GuestName,
+		StartDate: timestamppb.New(req.StartDate),
+		EndDate:   timestamppb.New(req.EndDate),
+		PromoCode: req.PromoCode,
+	}, r.URL.Query().Get("wait") == "true")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "cannot send command")
+		return
+	}
+
+	resp := bookRoomResponse{
+		CommandID:     result.CommandID,
+		ReservationID: result.ReservationID,
+		Status:        "pending",
+	}
+
+	switch {
+	case result.Outcome == nil:
+		writeJSON(w, http.StatusAccepted, resp)
+	case result.Outcome.Booked:
+		resp.Status = "booked"
+		writeJSON(w, http.StatusCreated, resp)
+	default:
+		resp.Status = "rejected"
+		resp.RejectionReason = result.Outcome.RejectionReason.String()
+		writeJSON(w, http.StatusConflict, resp)
+	}
+}
+
+func (a HTTPAPI) postOrderBeer(w http.ResponseWriter, r *http.Request) {
+	var req orderBeerRequest
+	if !readCommandRequest(w, r, &req, func() []string { return req.validate() }) {
+		return
+	}
+
+	a.sendCommand(w, r, &events.OrderBeer{
+		RoomId:   req.RoomID,
+		Count:    req.Count,
+		BeerType: req.BeerType,
+	})
+}
+
+func (a HTTPAPI) postRestockBeer(w http.ResponseWriter, r *http.Request) {
+	var req restockBeerRequest
+	if !readCommandRequest(w, r, &req, func() []string { return req.validate() }) {
+		return
+	}
+
+	a.sendCommand(w, r, &events.RestockBeer{
+		BeerType: req.BeerType,
+		Count:    req.Count,
+	})
+}
+
+func (a HTTPAPI) postModifyBooking(w http.ResponseWriter, r *http.Request) {
+	var req modifyBookingRequest
+	if !readCommandRequest(w, r, &req, func() []string { return req.validate() }) {
+		return
+	}
+
+	a.sendCommand(w, r, req.command())
+}
+
+func (a HTTPAPI) postCheckIn(w http.ResponseWriter, r *http.Request) {
+	var req reservationCommandRequest
+	if !readCommandRequest(w, r, &req, func() []string { return req.validate() }) {
+		return
+	}
+
+	a.sendCommand(w, r, &events.CheckIn{ReservationId: req.ReservationID})
+}
+
+func (a HTTPAPI) postCheckOut(w http.ResponseWriter, r *http.Request) {
+	var req reservationCommandRequest
+	if !readCommandRequest(w, r, &req, func() []string { return req.validate() }) {
+		return
+	}
+
+	a.sendCommand(w, r, &events.CheckOut{ReservationId: req.ReservationID})
+}
+
+// sendCommand sends the command and responds with its id.
+func (a HTTPAPI) sendCommand(w http.ResponseWriter, r *http.Request, cmd interface{}) {
+	commandID := watermill.NewUUID()
+
+	if err := a.commandBus.Send(WithMessageUUID(r.Context(), commandID), cmd); err != nil {
+		writeError(w, http.StatusInternalServerError, "cannot send command")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, commandResponse{CommandID: commandID})
+}
+
+type validationErrorResponse struct {
+	Error  string   `json:"error"`
+	Fields []string `json:"fields"`
+}
+
+// readCommandRequest decodes JSON body into req and validates it.
+// When the request is invalid, the error response is written and false is returned.
+func readCommandRequest(w http.ResponseWriter, r *http.Request, req interface{}, validate func() []string) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return false
+	}
+
+	if errs := validate(); len(errs) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, validationErrorResponse{
+			Error:  "invalid command",
+			Fields: errs,
+		})
+		return false
+	}
+
+	return true
+}
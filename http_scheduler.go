@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"main.go/events"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+type scheduleCommandRequest struct {
+	// Name is the name of the command, for example "OrderBeer"
+	Name string `json:"name"`
+	// Command is the command in protobuf JSON format
+	Command   json.RawMessage `json:"command"`
+	DeliverAt time.Time       `json:"deliver_at"`
+}
+
+// parse validates the request and returns its command.
+func (r scheduleCommandRequest) parse(scheduler *CommandScheduler) (proto.Message, []string) {
+	var errs []string
+
+	if r.DeliverAt.IsZero() {
+		errs = append(errs, "deliver_at is required")
+	}
+	if strings.TrimSpace(r.Name) == "" {
+		return nil, append(errs, "name is required")
+	}
+
+	cmd, err := scheduler.NewCommand(r.Name)
+	if err != nil {
+		return nil, append(errs, "name must be one of commands of the API")
+	}
+	if len(r.Command) > 0 {
+		if err := protojson.Unmarshal(r.Command, cmd); err != nil {
+			return nil, append(errs, "command is not valid "+r.Name+": "+err.Error())
+		}
+	}
+
+	return cmd, append(errs, validateScheduledCommand(cmd)...)
+}
+
+// validateScheduledCommand validates the command in the same way as the endpoint which sends it.
+func validateScheduledCommand(cmd proto.Message) []string {
+	switch c := cmd.(type) {
+	case *events.BookRoom:
+		return bookRoomRequest{
+			RoomID:    c.RoomId,
+			GuestName: c.GuestName,
+			StartDate: timeOrZero(c.StartDate),
+			EndDate:   timeOrZero(c.EndDate),
+		}.validate()
+	case *events.ModifyBooking:
+		return modifyBookingRequest{
+			ReservationID: c.ReservationId,
+			RoomID:        c.RoomId,
+			StartDate:     timeOrZero(c.StartDate),
+			EndDate:       timeOrZero(c.EndDate),
+		}.validate()
+	case *events.CancelBooking:
+		return reservationCommandRequest{ReservationID: c.ReservationId}.validate()
+	case *events.CheckIn:
+		return reservationCommandRequest{ReservationID: c.ReservationId}.validate()
+	case *events.CheckOut:
+		return reservationCommandRequest{ReservationID: c.ReservationId}.validate()
+	case *events.OrderBeer:
+		return orderBeerRequest{RoomID: c.RoomId, Count: c.Count, BeerType: c.BeerType}.validate()
+	case *events.RestockBeer:
+		return restockBeerRequest{BeerType: c.BeerType, Count: c.Count}.validate()
+	default:
+		return []string{"command " + string(proto.MessageName(cmd)) + " can't be scheduled"}
+	}
+}
+
+// scheduledCommandView is ScheduledCommand as it is presented by HTTP API.
+type scheduledCommandView struct {
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	Command   json.RawMessage        `json:"command"`
+	DeliverAt time.Time              `json:"deliver_at"`
+	Status    ScheduledCommandStatus `json:"status"`
+	CreatedAt time.Time              `json:"created_at"`
+	SentAt    *time.Time             `json:"sent_at,omitempty"`
+}
+
+type scheduledCommandsResponse struct {
+	Items []scheduledCommandView `json:"items"`
+}
+
+// postScheduleCommand schedules the command, the response contains its id, which is also UUID of the sent command.
+func (a HTTPAPI) postScheduleCommand(w http.ResponseWriter, r *http.Request) {
+	var req scheduleCommandRequest
+	var cmd proto.Message
+	if !readCommandRequest(w, r, &req, func() []string {
+		var errs []string
+		cmd, errs = req.parse(a.scheduler)
+		return errs
+	}) {
+		return
+	}
+
+	id, err := a.scheduler.Schedule(r.Context(), cmd, req.DeliverAt)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "cannot schedule command")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, commandResponse{CommandID: id})
+}
+
+// getScheduledCommands lists scheduled commands, optionally filtered by ?status=.
+func (a HTTPAPI) getScheduledCommands(w http.ResponseWriter, r *http.Request) {
+	status := ScheduledCommandStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", ScheduledCommandPending, ScheduledCommandSent, ScheduledCommandCancelled:
+	default:
+		writeError(w, http.StatusBadRequest, "status must be scheduled, sent or cancelled")
+		return
+	}
+
+	commands, err := a.scheduler.List(r.Context(), status)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "cannot list scheduled commands")
+		return
+	}
+
+	resp := scheduledCommandsResponse{Items: []scheduledCommandView{}}
+	for _, cmd := range commands {
+		command, err := protojson.Marshal(cmd.Command)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "cannot marshal scheduled command")
+			return
+		}
+
+		resp.Items = append(resp.Items, scheduledCommandView{
+			ID:        cmd.ID,
+			Name:      cmd.Name,
+			Command:   command,
+			DeliverAt: cmd.DeliverAt,
+			Status:    cmd.Status,
+			CreatedAt: cmd.CreatedAt,
+			SentAt:    cmd.SentAt,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// deleteScheduledCommand cancels the scheduled command, which was not sent yet.
+func (a HTTPAPI) deleteScheduledCommand(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/scheduled-commands/")
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	err := a.scheduler.Cancel(r.Context(), id)
+	switch errors.Cause(err) {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case ErrScheduledCommandNotFound:
+		writeError(w, http.StatusNotFound, "scheduled command not found")
+	case ErrScheduledCommandNotPending:
+		writeError(w, http.StatusConflict, "scheduled command was already sent or cancelled")
+	default:
+		writeError(w, http.StatusInternalServerError, "cannot cancel scheduled command")
+	}
+}
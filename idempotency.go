@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// IdempotencyKeyFunc returns the key by which the message is deduplicated, empty key disables deduplication of the message.
+// The key is unique only within the handler, so the same message may be handled once by every handler.
+type IdempotencyKeyFunc func(msg *message.Message) (string, error)
+
+// MessageUUIDKey deduplicates redelivered messages.
+func MessageUUIDKey(msg *message.Message) (string, error) {
+	return msg.UUID, nil
+}
+
+// EventKey deduplicates events of the cqrs event handler by the key returned by eventKey (for example id of the aggregate).
+// When eventKey is nil, events are deduplicated by UUID.
+//
+// Event handler receives all events from the topic and ignores events of other types, so they are not deduplicated.
+func EventKey(
+	marshaler cqrs.CommandEventMarshaler,
+	handler cqrs.EventHandler,
+	eventKey func(event proto.Message) string,
+) IdempotencyKeyFunc {
+	eventName := marshaler.Name(handler.NewEvent())
+
+	return func(msg *message.Message) (string, error) {
+		if marshaler.NameFromMessage(msg) != eventName {
+			return "", nil
+		}
+		if eventKey == nil {
+			return msg.UUID, nil
+		}
+
+		event, ok := handler.NewEvent().(proto.Message)
+		if !ok {
+			return "", errors.Errorf("%T is not proto.Message", handler.NewEvent())
+		}
+		if err := marshaler.Unmarshal(msg, event); err != nil {
+			return "", err
+		}
+
+		return eventKey(event), nil
+	}
+}
+
+// IdempotencyMiddleware skips messages which were already handled successfully by the handler.
+//
+// Message is marked as handled after the handler succeeds, so when the service crashes in between,
+// the message is handled again. Handlers must still tolerate rare duplicates, but redeliveries
+// by the broker and messages handled before restart are skipped. Handlers which can't tolerate them
+// should save keys of handled messages atomically with their state (like BookingsFinancialReport).
+type IdempotencyMiddleware struct {
+	store *IdempotencyStore
+
+	// handlers are names of deduplicated handlers with the key of their messages
+	handlers map[string]IdempotencyKeyFunc
+}
+
+func NewIdempotencyMiddleware(store *IdempotencyStore, handlers map[string]IdempotencyKeyFunc) IdempotencyMiddleware {
+	return IdempotencyMiddleware{store, handlers}
+}
+
+func (m IdempotencyMiddleware) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		handlerName := message.HandlerNameFromCtx(msg.Context())
+
+		keyFunc, ok := m.handlers[handlerName]
+		if !ok {
+			return h(msg)
+		}
+
+		key, err := keyFunc(msg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot get idempotency key of message %s", msg.UUID)
+		}
+		if key == "" {
+			return h(msg)
+		}
+
+		processed, err := m.store.Processed(msg.Context(), handlerName, key)
+		if err != nil {
+			return nil, err
+		}
+		if processed {
+			logf(msg.Context(), "Message %s was already handled by %s, skipping", msg.UUID, handlerName)
+			return nil, nil
+		}
+
+		produced, err := h(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := m.store.MarkProcessed(msg.Context(), handlerName, key); err != nil {
+			return nil, err
+		}
+
+		return produced, nil
+	}
+}
+
+// IdempotencyStore remembers keys of handled messages in SQLite, so they are deduplicated also after restart.
+// Keys expire after ttl, to keep the table small; the message must not be redelivered after that.
+type IdempotencyStore struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+func NewIdempotencyStore(db *sql.DB, ttl time.Duration) (*IdempotencyStore, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS processed_messages (
+			handler TEXT NOT NULL,
+			key TEXT NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (handler, key)
+		)`,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create processed_messages table")
+	}
+
+	return &IdempotencyStore{db, ttl}, nil
+}
+
+// Processed returns true when the key was marked as processed by the handler and it didn't expire yet.
+func (s *IdempotencyStore) Processed(ctx context.Context, handler string, key string) (bool, error) {
+	var count int
+	if err := s.db.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*) FROM processed_messages WHERE handler = ? AND key = ? AND expires_at > ?`,
+		handler, key, time.Now().UTC(),
+	).Scan(&count); err != nil {
+		return false, errors.Wrapf(err, "cannot check if %s processed %s", handler, key)
+	}
+
+	return count > 0, nil
+}
+
+func (s *IdempotencyStore) MarkProcessed(ctx context.Context, handler string, key string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT OR REPLACE INTO processed_messages (handler, key, expires_at) VALUES (?, ?, ?)`,
+		handler, key, time.Now().UTC().Add(s.ttl),
+	)
+	return errors.Wrapf(err, "cannot mark %s as processed by %s", key, handler)
+}
+
+// DeleteExpired removes expired keys and returns how many of them were removed.
+func (s *IdempotencyStore) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM processed_messages WHERE expires_at <= ?`, time.Now().UTC())
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot delete expired idempotency keys")
+	}
+
+	return result.RowsAffected()
+}
+
+// RunCleanup deletes expired keys with the given interval until ctx is done.
+func (s *IdempotencyStore) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := s.DeleteExpired(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Cannot clean up idempotency keys: %s", err)
+		}
+	}
+}
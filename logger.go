@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// LogLevel is the minimal level of logged messages.
+type LogLevel int32
+
+const (
+	LogLevelTrace LogLevel = iota
+	LogLevelDebug
+	LogLevelInfo
+	LogLevelError
+)
+
+var logLevelNames = map[LogLevel]string{
+	LogLevelTrace: "trace",
+	LogLevelDebug: "debug",
+	LogLevelInfo:  "info",
+	LogLevelError: "error",
+}
+
+func (l LogLevel) String() string {
+	return logLevelNames[l]
+}
+
+// ParseLogLevel parses level name: "trace", "debug", "info" or "error".
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range logLevelNames {
+		if levelName == strings.ToLower(name) {
+			return level, nil
+		}
+	}
+
+	return 0, errors.Errorf("unknown log level %q", name)
+}
+
+// Logger is structured watermill.LoggerAdapter writing one JSON object or logfmt line per message.
+//
+// Loggers created by With share the level with their parent, so the level of all of them can be changed at runtime.
+type Logger struct {
+	out    io.Writer
+	json   bool
+	level  *int32
+	fields watermill.LogFields
+	lock   *sync.Mutex
+}
+
+// NewLogger creates logger writing to out in the given format: "json" or "logfmt".
+func NewLogger(out io.Writer, format string, level LogLevel) (*Logger, error) {
+	if format != "json" && format != "logfmt" {
+		return nil, errors.Errorf("unknown log format %q", format)
+	}
+
+	l := int32(level)
+	return &Logger{out: out, json: format == "json", level: &l, lock: &sync.Mutex{}}, nil
+}
+
+func (l *Logger) Level() LogLevel {
+	return LogLevel(atomic.LoadInt32(l.level))
+}
+
+func (l *Logger) SetLevel(level LogLevel) {
+	atomic.StoreInt32(l.level, int32(level))
+}
+
+func (l *Logger) Error(msg string, err error, fields watermill.LogFields) {
+	l.log(LogLevelError, msg, err, fields)
+}
+
+func (l *Logger) Info(msg string, fields watermill.LogFields) {
+	l.log(LogLevelInfo, msg, nil, fields)
+}
+
+func (l *Logger) Debug(msg string, fields watermill.LogFields) {
+	l.log(LogLevelDebug, msg, nil, fields)
+}
+
+func (l *Logger) Trace(msg string, fields watermill.LogFields) {
+	l.log(LogLevelTrace, msg, nil, fields)
+}
+
+func (l *Logger) With(fields watermill.LogFields) watermill.LoggerAdapter {
+	return &Logger{out: l.out, json: l.json, level: l.level, fields: l.fields.Add(fields), lock: l.lock}
+}
+
+func (l *Logger) log(level LogLevel, msg string, err error, fields watermill.LogFields) {
+	if level < l.Level() {
+		return
+	}
+
+	fields = l.fields.Add(fields)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// time, level and message are always first, so the logs are easy to read
+	line := &bytes.Buffer{}
+	l.beginLine(line)
+	l.writeField(line, "time", time.Now().UTC().Format(time.RFC3339Nano))
+	l.writeField(line, "level", level.String())
+	l.writeField(line, "msg", msg)
+	if err != nil {
+		l.writeField(line, "error", err.Error())
+	}
+	for _, key := range keys {
+		l.writeField(line, key, fields[key])
+	}
+	l.endLine(line)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, _ = l.out.Write(line.Bytes())
+}
+
+func (l *Logger) beginLine(line *bytes.Buffer) {
+	if l.json {
+		line.WriteByte('{')
+	}
+}
+
+func (l *Logger) writeField(line *bytes.Buffer, key string, value interface{}) {
+	if l.json {
+		if line.Len() > 1 {
+			line.WriteByte(',')
+		}
+
+		b, err := json.Marshal(value)
+		if err != nil {
+			b, _ = json.Marshal(fmt.Sprint(value))
+		}
+		line.WriteString(strconv.Quote(key))
+		line.WriteByte(':')
+		line.Write(b)
+		return
+	}
+
+	if line.Len() > 0 {
+		line.WriteByte(' ')
+	}
+
+	s := fmt.Sprint(value)
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		s = strconv.Quote(s)
+	}
+	line.WriteString(key)
+	line.WriteByte('=')
+	line.WriteString(s)
+}
+
+func (l *Logger) endLine(line *bytes.Buffer) {
+	if l.json {
+		line.WriteByte('}')
+	}
+	line.WriteByte('\n')
+}
+
+// Writer returns io.Writer logging every written line with info level, it's used as output of the standard logger.
+func (l *Logger) Writer() io.Writer {
+	return loggerWriter{l}
+}
+
+type loggerWriter struct {
+	logger *Logger
+}
+
+func (w loggerWriter) Write(p []byte) (int, error) {
+	w.logger.Info(strings.TrimRight(string(p), "\n"), nil)
+	return len(p), nil
+}
+
+// LevelHandler returns the current log level (GET) or changes it (PUT), the body is JSON {"level": "debug"}.
+func (l *Logger) LevelHandler() http.Handler {
+	type levelBody struct {
+		Level string `json:"level"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var body levelBody
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+				return
+			}
+
+			level, err := ParseLogLevel(body.Level)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			l.SetLevel(level)
+			l.Info("Log level changed", watermill.LogFields{"log_level": level.String()})
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, levelBody{Level: l.Level().String()})
+	})
+}
+
+type loggerCtxKey struct{}
+
+// LoggerFromContext returns logger of the message handled with this context (see LoggingMiddleware).
+func LoggerFromContext(ctx context.Context) (watermill.LoggerAdapter, bool) {
+	logger, ok := ctx.Value(loggerCtxKey{}).(watermill.LoggerAdapter)
+	return logger, ok
+}
+
+// logf logs the message with info level by the logger of the handled message, so it has all its fields.
+// Outside of handlers, the standard logger is used.
+func logf(ctx context.Context, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+
+	if logger, ok := LoggerFromContext(ctx); ok {
+		logger.Info(msg, nil)
+	} else {
+		log.Print(msg)
+	}
+}
+
+// LoggingMiddleware is router middleware, which sets logger of the handled message in its context.
+// The logger adds UUID, handler, topic, correlation and causation id of the message to every log,
+// and reservation id, when the message has it.
+type LoggingMiddleware struct {
+	logger    watermill.LoggerAdapter
+	marshaler cqrs.CommandEventMarshaler
+
+	// messageTypes are all registered protobuf messages by their name given by the marshaler
+	messageTypes map[string]protoreflect.MessageType
+}
+
+func NewLoggingMiddleware(logger watermill.LoggerAdapter, marshaler cqrs.CommandEventMarshaler) LoggingMiddleware {
+	messageTypes := map[string]protoreflect.MessageType{}
+	protoregistry.GlobalTypes.RangeMessages(func(messageType protoreflect.MessageType) bool {
+		messageTypes[marshaler.Name(messageType.New().Interface())] = messageType
+		return true
+	})
+
+	return LoggingMiddleware{logger, marshaler, messageTypes}
+}
+
+func (m LoggingMiddleware) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		fields := watermill.LogFields{
+			"message_uuid":   msg.UUID,
+			"handler":        message.HandlerNameFromCtx(msg.Context()),
+			"topic":          message.SubscribeTopicFromCtx(msg.Context()),
+			"correlation_id": msg.Metadata.Get(CorrelationIDKey),
+		}
+		if causationID := msg.Metadata.Get(CausationIDKey); causationID != "" {
+			fields["causation_id"] = causationID
+		}
+		if reservationID := m.reservationID(msg); reservationID != "" {
+			fields["reservation_id"] = reservationID
+		}
+
+		msg.SetContext(context.WithValue(msg.Context(), loggerCtxKey{}, m.logger.With(fields)))
+		return h(msg)
+	}
+}
+
+// reservationID returns reservation_id field of the message, if it's a command or event which has it.
+func (m LoggingMiddleware) reservationID(msg *message.Message) string {
+	messageType, ok := m.messageTypes[msg.Metadata.Get("name")]
+	if !ok {
+		return ""
+	}
+
+	protoMsg := messageType.New().Interface()
+	if err := m.marshaler.Unmarshal(msg, protoMsg); err != nil {
+		return ""
+	}
+
+	field := protoMsg.ProtoReflect().Descriptor().Fields().ByName("reservation_id")
+	if field == nil || field.Kind() != protoreflect.StringKind {
+		return ""
+	}
+
+	return protoMsg.ProtoReflect().Get(field).String()
+}
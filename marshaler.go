@@ -0,0 +1,60 @@
+package main
+
+import (
+	"main.go/events"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtobufMarshaler is cqrs.ProtobufMarshaler which is using google.golang.org/protobuf instead of gogo/protobuf.
+//
+// gogo/protobuf is not able to unmarshal messages generated by the new protoc-gen-go (like the ones in events package),
+// so we only need to replace Marshal and Unmarshal, naming stays the same.
+type ProtobufMarshaler struct {
+	cqrs.ProtobufMarshaler
+}
+
+func (m ProtobufMarshaler) Marshal(v interface{}) (*message.Message, error) {
+	protoMsg, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("%T is not proto.Message", v)
+	}
+
+	b, err := proto.Marshal(protoMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := message.NewMessage(watermill.NewUUID(), b)
+	msg.Metadata.Set("name", m.Name(v))
+
+	return msg, nil
+}
+
+func (ProtobufMarshaler) Unmarshal(msg *message.Message, v interface{}) error {
+	protoMsg, ok := v.(proto.Message)
+	if !ok {
+		return errors.Errorf("%T is not proto.Message", v)
+	}
+
+	return proto.Unmarshal(msg.Payload, protoMsg)
+}
+
+// allCommands are all commands handled by the service, stored commands (dead letters and scheduled commands)
+// are decoded with them.
+var allCommands = []proto.Message{
+	&events.BookRoom{},
+	&events.CancelBooking{},
+	&events.ModifyBooking{},
+	&events.CheckIn{},
+	&events.CheckOut{},
+	&events.OrderBeer{},
+	&events.RestockBeer{},
+	&events.CancelBeerOrder{},
+	&events.NotifyGuest{},
+	&events.ApplyCredit{},
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"main.go/events"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "hotel"
+
+// Metrics are Prometheus metrics of handlers, publishers and read models, served by HTTP API at /metrics.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	messagesHandled  *prometheus.CounterVec
+	handlerFailures  *prometheus.CounterVec
+	handlerRetries   *prometheus.CounterVec
+	handlingDuration *prometheus.HistogramVec
+	publishDuration  *prometheus.HistogramVec
+	beersOrdered     prometheus.Counter
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		messagesHandled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "messages_handled_total",
+			Help:      "Number of messages handled successfully.",
+		}, []string{"handler_name"}),
+		handlerFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "handler_failures_total",
+			Help:      "Number of failed attempts to handle a message.",
+		}, []string{"handler_name"}),
+		handlerRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "handler_retries_total",
+			Help:      "Number of retries of failed commands.",
+		}, []string{"handler_name"}),
+		handlingDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "handler_duration_seconds",
+			Help:      "Duration of a single attempt to handle a message.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"handler_name", "success"}),
+		publishDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "publish_duration_seconds",
+			Help:      "Duration of publishing messages to the transport.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"topic", "success"}),
+		beersOrdered: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "beers_ordered_total",
+			Help:      "Number of ordered beers.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.messagesHandled,
+		m.handlerFailures,
+		m.handlerRetries,
+		m.handlingDuration,
+		m.publishDuration,
+		m.beersOrdered,
+	)
+
+	return m
+}
+
+// Handler serves metrics in Prometheus format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware is router middleware measuring every attempt to handle a message.
+// It should be added after DeadLetterMiddleware, so every retry is measured separately.
+func (m *Metrics) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		handlerName := message.HandlerNameFromCtx(msg.Context())
+
+		if attempts, _ := strconv.Atoi(msg.Metadata.Get(AttemptsKey)); attempts > 1 {
+			m.handlerRetries.WithLabelValues(handlerName).Inc()
+		}
+
+		start := time.Now()
+		produced, err := h(msg)
+		m.handlingDuration.WithLabelValues(handlerName, strconv.FormatBool(err == nil)).Observe(time.Since(start).Seconds())
+
+		if err != nil {
+			m.handlerFailures.WithLabelValues(handlerName).Inc()
+		} else {
+			m.messagesHandled.WithLabelValues(handlerName).Inc()
+		}
+
+		return produced, err
+	}
+}
+
+// ObserveFinancialReport exposes total revenue of booked rooms from BookingsFinancialReport.
+func (m *Metrics) ObserveFinancialReport(report *BookingsFinancialReport) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "booked_revenue",
+		Help:      "Total charge of booked rooms, reduced by refunds of cancelled bookings.",
+	}, func() float64 {
+		return float64(report.View().TotalCharge)
+	}))
+}
+
+// BeerOrderedHandler is event handler counting ordered beers.
+func (m *Metrics) BeerOrderedHandler() cqrs.EventHandler {
+	return eventHandler{
+		name:     "MetricsOnBeerOrdered",
+		newEvent: func() interface{} { return &events.BeerOrdered{} },
+		handle: func(ctx context.Context, e interface{}) error {
+			m.beersOrdered.Add(float64(e.(*events.BeerOrdered).Count))
+			return nil
+		},
+	}
+}
+
+// MetricsPublisher is message.Publisher decorator, which measures how long publishing to each topic takes.
+type MetricsPublisher struct {
+	publisher message.Publisher
+	metrics   *Metrics
+}
+
+func NewMetricsPublisher(publisher message.Publisher, metrics *Metrics) MetricsPublisher {
+	return MetricsPublisher{publisher, metrics}
+}
+
+func (p MetricsPublisher) Publish(topic string, messages ...*message.Message) error {
+	start := time.Now()
+	err := p.publisher.Publish(topic, messages...)
+	p.metrics.publishDuration.WithLabelValues(topic, strconv.FormatBool(err == nil)).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+func (p MetricsPublisher) Close() error {
+	return p.publisher.Close()
+}
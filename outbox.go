@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+)
+
+// outboxBatchSize is the number of messages loaded from the outbox at once by OutboxRelay.
+const outboxBatchSize = 100
+
+// Outbox keeps messages which should be published, in the same SQLite database as the event store.
+// Messages are added in the transaction which changes the state, so the state is never changed
+// without publishing its events (and events are never published without changing the state).
+// Besides events, it keeps commands sent by processes (see ProcessManager).
+type Outbox struct {
+	db *sql.DB
+
+	// added is signalled when a message is added, so the relay doesn't wait for the next poll
+	added chan struct{}
+}
+
+func NewOutbox(db *sql.DB) (*Outbox, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS outbox (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			topic TEXT NOT NULL,
+			uuid TEXT NOT NULL,
+			payload BLOB NOT NULL,
+			metadata TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		)`,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create outbox table")
+	}
+
+	return &Outbox{db: db, added: make(chan struct{}, 1)}, nil
+}
+
+// Add stores messages to be published to the topic.
+// When ctx has a transaction (see runInTx), messages are stored in it.
+func (o *Outbox) Add(ctx context.Context, topic string, messages ...*message.Message) error {
+	err := runInTx(ctx, o.db, func(ctx context.Context) error {
+		tx, _ := txFromContext(ctx)
+
+		for _, msg := range messages {
+			metadata, err := json.Marshal(msg.Metadata)
+			if err != nil {
+				return errors.Wrap(err, "cannot marshal metadata")
+			}
+
+			if _, err := tx.ExecContext(
+				ctx,
+				`INSERT INTO outbox (topic, uuid, payload, metadata, created_at) VALUES (?, ?, ?, ?, ?)`,
+				topic, msg.UUID, []byte(msg.Payload), string(metadata), time.Now().UTC(),
+			); err != nil {
+				return errors.Wrapf(err, "cannot add message %s to outbox", msg.UUID)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Relay can't read the messages before the transaction is committed, because the database has only one connection.
+	select {
+	case o.added <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// OutboxPublisher is message.Publisher, which stores messages in Outbox instead of sending them,
+// they are sent by OutboxRelay after the transaction is committed.
+// When the message context has a transaction (see runInTx), the message is stored in it.
+type OutboxPublisher struct {
+	outbox *Outbox
+}
+
+func NewOutboxPublisher(outbox *Outbox) OutboxPublisher {
+	return OutboxPublisher{outbox}
+}
+
+func (p OutboxPublisher) Publish(topic string, messages ...*message.Message) error {
+	for _, msg := range messages {
+		if err := p.outbox.Add(msg.Context(), topic, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p OutboxPublisher) Close() error {
+	return nil
+}
+
+type outboxMessage struct {
+	id    int64
+	topic string
+	msg   *message.Message
+}
+
+func (o *Outbox) load(ctx context.Context, limit int) ([]outboxMessage, error) {
+	rows, err := o.db.QueryContext(ctx, `SELECT id, topic, uuid, payload, metadata FROM outbox ORDER BY id LIMIT ?`, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot query outbox")
+	}
+	defer rows.Close()
+
+	var messages []outboxMessage
+	for rows.Next() {
+		var m outboxMessage
+		var uuid, metadata string
+		var payload []byte
+
+		if err := rows.Scan(&m.id, &m.topic, &uuid, &payload, &metadata); err != nil {
+			return nil, errors.Wrap(err, "cannot scan outbox message")
+		}
+
+		m.msg = message.NewMessage(uuid, payload)
+		if err := json.Unmarshal([]byte(metadata), &m.msg.Metadata); err != nil {
+			return nil, errors.Wrapf(err, "cannot unmarshal metadata of outbox message %d", m.id)
+		}
+
+		messages = append(messages, m)
+	}
+
+	return messages, errors.Wrap(rows.Err(), "cannot iterate outbox")
+}
+
+func (o *Outbox) remove(ctx context.Context, id int64) error {
+	_, err := o.db.ExecContext(ctx, `DELETE FROM outbox WHERE id = ?`, id)
+	return errors.Wrapf(err, "cannot remove outbox message %d", id)
+}
+
+// Pending returns the number of messages which were not published yet and when the oldest of them was added.
+// When the outbox is empty, the returned time is zero.
+func (o *Outbox) Pending(ctx context.Context) (int, time.Time, error) {
+	var count int
+	if err := o.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM outbox`).Scan(&count); err != nil {
+		return 0, time.Time{}, errors.Wrap(err, "cannot count outbox messages")
+	}
+	if count == 0 {
+		return 0, time.Time{}, nil
+	}
+
+	var oldest time.Time
+	err := o.db.QueryRowContext(ctx, `SELECT created_at FROM outbox ORDER BY id LIMIT 1`).Scan(&oldest)
+	if err == sql.ErrNoRows {
+		// published in the meantime
+		return 0, time.Time{}, nil
+	}
+
+	return count, oldest, errors.Wrap(err, "cannot read oldest outbox message")
+}
+
+// OutboxRelay publishes messages from Outbox, in the order in which they were added.
+//
+// Message is removed from the outbox after it's published, when the removal fails
+// (or the service crashes in between), the message is published again. Handlers must be ready for duplicates.
+type OutboxRelay struct {
+	outbox       *Outbox
+	publisher    message.Publisher
+	pollInterval time.Duration
+}
+
+func NewOutboxRelay(outbox *Outbox, publisher message.Publisher, pollInterval time.Duration) OutboxRelay {
+	return OutboxRelay{outbox, publisher, pollInterval}
+}
+
+// Run publishes messages until ctx is done.
+func (r OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.publishAll(ctx); err != nil && ctx.Err() == nil {
+			// failed message stays in the outbox, it's published again with the next poll
+			log.Printf("Cannot publish messages from outbox: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.outbox.added:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r OutboxRelay) publishAll(ctx context.Context) error {
+	for {
+		messages, err := r.outbox.load(ctx, outboxBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		for _, m := range messages {
+			// the first failure stops publishing, so the order of messages is kept
+			if err := r.publisher.Publish(m.topic, m.msg); err != nil {
+				return errors.Wrapf(err, "cannot publish message %s", m.msg.UUID)
+			}
+			if err := r.outbox.remove(ctx, m.id); err != nil {
+				return err
+			}
+		}
+	}
+}
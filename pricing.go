@@ -0,0 +1,193 @@
+package main
+
+import (
+	"main.go/events"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxStayNights is the longest stay which can be booked, longer stays are rejected by the API and by Pricing.
+const maxStayNights = 365
+
+var (
+	ErrInvalidPromoCode = errors.New("promo code is not valid")
+	ErrStayTooLong      = errors.Errorf("stay can't be longer than %d nights", maxStayNights)
+)
+
+// Pricing calculates the price of a stay.
+//
+// BookRoomHandler depends only on this interface, so it can be used with deterministic prices.
+type Pricing interface {
+	// Price returns the price of the room from startDate to endDate, discounted by promoCode when it's not empty.
+	// ErrStayTooLong is returned when the stay is longer than maxStayNights.
+	Price(roomID string, startDate, endDate time.Time, promoCode string) (*events.PriceBreakdown, error)
+}
+
+// ConfiguredPricing calculates prices from PricingConfig.
+//
+// Every night is charged by the base rate of the room type, multiplied by the weekend and season multipliers.
+// Length-of-stay discount is subtracted from the sum of all nights, and the promo code discount from the rest.
+// Nights are calendar days in UTC, a stay shorter than a day is charged as one night.
+type ConfiguredPricing struct {
+	config  PricingConfig
+	seasons []season
+}
+
+func NewConfiguredPricing(config PricingConfig) (*ConfiguredPricing, error) {
+	p := &ConfiguredPricing{config: config}
+
+	for _, s := range config.Seasons {
+		from, err := parseSeasonDay(s.From)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid start of season %s", s.Name)
+		}
+		to, err := parseSeasonDay(s.To)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid end of season %s", s.Name)
+		}
+
+		p.seasons = append(p.seasons, season{name: s.Name, from: from, to: to, multiplier: s.Multiplier})
+	}
+
+	return p, nil
+}
+
+func (p *ConfiguredPricing) Price(roomID string, startDate, endDate time.Time, promoCode string) (*events.PriceBreakdown, error) {
+	if !startDate.Before(endDate) {
+		return nil, ErrInvalidBookingDates
+	}
+	if stayTooLong(startDate, endDate) {
+		return nil, ErrStayTooLong
+	}
+
+	var promoPercent int64
+	if promoCode != "" {
+		var ok bool
+		if promoPercent, ok = p.config.PromoCodes[promoCode]; !ok {
+			return nil, ErrInvalidPromoCode
+		}
+	}
+
+	roomType, ok := p.config.Rooms[roomID]
+	if !ok {
+		roomType = p.config.DefaultRoomType
+	}
+	baseRate := p.config.RoomTypes[roomType]
+
+	breakdown := &events.PriceBreakdown{RoomType: roomType, PromoCode: promoCode}
+
+	for _, night := range stayNights(startDate, endDate) {
+		nightPrice := &events.NightPrice{
+			Date:       timestamppb.New(night),
+			BaseRate:   baseRate,
+			Multiplier: 1,
+		}
+
+		if night.Weekday() == time.Friday || night.Weekday() == time.Saturday {
+			nightPrice.Multiplier *= p.config.WeekendMultiplier
+		}
+		if s, ok := p.season(night); ok {
+			nightPrice.Season = s.name
+			nightPrice.Multiplier *= s.multiplier
+		}
+		nightPrice.Price = int64(math.Round(float64(baseRate) * nightPrice.Multiplier))
+
+		breakdown.Nights = append(breakdown.Nights, nightPrice)
+		breakdown.Subtotal += nightPrice.Price
+	}
+
+	breakdown.LengthOfStayDiscount = breakdown.Subtotal * p.lengthOfStayPercent(len(breakdown.Nights)) / 100
+	breakdown.PromoDiscount = (breakdown.Subtotal - breakdown.LengthOfStayDiscount) * promoPercent / 100
+	breakdown.Total = breakdown.Subtotal - breakdown.LengthOfStayDiscount - breakdown.PromoDiscount
+
+	return breakdown, nil
+}
+
+func (p *ConfiguredPricing) season(night time.Time) (season, bool) {
+	for _, s := range p.seasons {
+		if s.contains(night) {
+			return s, true
+		}
+	}
+
+	return season{}, false
+}
+
+func (p *ConfiguredPricing) lengthOfStayPercent(nights int) int64 {
+	var percent int64
+	minNights := 0
+
+	for _, discount := range p.config.LengthOfStayDiscounts {
+		if nights >= discount.MinNights && discount.MinNights > minNights {
+			percent = discount.Percent
+			minNights = discount.MinNights
+		}
+	}
+
+	return percent
+}
+
+// stayNights returns dates (midnight in UTC) of all nights of the stay.
+func stayNights(startDate, endDate time.Time) []time.Time {
+	first := startOfDay(startDate)
+	last := startOfDay(endDate)
+
+	nights := []time.Time{first}
+	for night := first.AddDate(0, 0, 1); night.Before(last); night = night.AddDate(0, 0, 1) {
+		nights = append(nights, night)
+	}
+
+	return nights
+}
+
+// stayTooLong returns true when the stay has more than maxStayNights nights.
+func stayTooLong(startDate, endDate time.Time) bool {
+	return startOfDay(startDate).AddDate(0, 0, maxStayNights).Before(startOfDay(endDate))
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+type season struct {
+	name       string
+	from       seasonDay
+	to         seasonDay
+	multiplier float64
+}
+
+// contains returns true when the date is between the first and the last day of the season (inclusive).
+func (s season) contains(date time.Time) bool {
+	day := seasonDay{date.Month(), date.Day()}
+
+	if !s.to.before(s.from) {
+		return !day.before(s.from) && !s.to.before(day)
+	}
+
+	// season over the new year, for example from 12-20 to 01-06
+	return !day.before(s.from) || !s.to.before(day)
+}
+
+// seasonDay is a day of the year, regardless of the year.
+type seasonDay struct {
+	month time.Month
+	day   int
+}
+
+func (d seasonDay) before(other seasonDay) bool {
+	return d.month < other.month || (d.month == other.month && d.day < other.day)
+}
+
+// parseSeasonDay parses day in MM-DD format.
+func parseSeasonDay(s string) (seasonDay, error) {
+	t, err := time.Parse("01-02", s)
+	if err != nil {
+		return seasonDay{}, errors.Errorf("%q is not in MM-DD format", s)
+	}
+
+	return seasonDay{t.Month(), t.Day()}, nil
+}
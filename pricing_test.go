@@ -0,0 +1,222 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestConfiguredPricing_Price(t *testing.T) {
+	pricing, err := NewConfiguredPricing(PricingConfig{
+		RoomTypes:         map[string]int64{"standard": 100, "suite": 200},
+		Rooms:             map[string]string{"101": "suite"},
+		DefaultRoomType:   "standard",
+		WeekendMultiplier: 1.5,
+		Seasons: []SeasonConfig{
+			{Name: "christmas", From: "12-20", To: "01-06", Multiplier: 2},
+		},
+		LengthOfStayDiscounts: []LengthOfStayDiscountConfig{
+			{MinNights: 7, Percent: 10},
+			{MinNights: 3, Percent: 5},
+		},
+		PromoCodes: map[string]int64{"SPRING": 20},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2027-03-01 is Monday
+	testCases := []struct {
+		name      string
+		roomID    string
+		startDate time.Time
+		endDate   time.Time
+		promoCode string
+
+		wantErr                  error
+		wantNights               int
+		wantSubtotal             int64
+		wantLengthOfStayDiscount int64
+		wantPromoDiscount        int64
+		wantTotal                int64
+	}{
+		{
+			name:         "weekdays",
+			roomID:       "1",
+			startDate:    time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			endDate:      time.Date(2027, 3, 3, 0, 0, 0, 0, time.UTC),
+			wantNights:   2,
+			wantSubtotal: 200,
+			wantTotal:    200,
+		},
+		{
+			name:         "room_type",
+			roomID:       "101",
+			startDate:    time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			endDate:      time.Date(2027, 3, 2, 0, 0, 0, 0, time.UTC),
+			wantNights:   1,
+			wantSubtotal: 200,
+			wantTotal:    200,
+		},
+		{
+			name:         "weekend",
+			roomID:       "1",
+			startDate:    time.Date(2027, 3, 5, 0, 0, 0, 0, time.UTC),
+			endDate:      time.Date(2027, 3, 7, 0, 0, 0, 0, time.UTC),
+			wantNights:   2,
+			wantSubtotal: 300,
+			wantTotal:    300,
+		},
+		{
+			// Wednesday and Thursday in the season, Friday both in the season and weekend
+			name:                     "season_across_new_year",
+			roomID:                   "1",
+			startDate:                time.Date(2026, 12, 30, 0, 0, 0, 0, time.UTC),
+			endDate:                  time.Date(2027, 1, 2, 0, 0, 0, 0, time.UTC),
+			wantNights:               3,
+			wantSubtotal:             700,
+			wantLengthOfStayDiscount: 35,
+			wantTotal:                665,
+		},
+		{
+			name:         "last_day_of_season",
+			roomID:       "1",
+			startDate:    time.Date(2027, 1, 6, 0, 0, 0, 0, time.UTC),
+			endDate:      time.Date(2027, 1, 8, 0, 0, 0, 0, time.UTC),
+			wantNights:   2,
+			wantSubtotal: 300,
+			wantTotal:    300,
+		},
+		{
+			name:                     "length_of_stay_discount",
+			roomID:                   "1",
+			startDate:                time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			endDate:                  time.Date(2027, 3, 4, 0, 0, 0, 0, time.UTC),
+			wantNights:               3,
+			wantSubtotal:             300,
+			wantLengthOfStayDiscount: 15,
+			wantTotal:                285,
+		},
+		{
+			name:                     "highest_length_of_stay_discount",
+			roomID:                   "1",
+			startDate:                time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			endDate:                  time.Date(2027, 3, 8, 0, 0, 0, 0, time.UTC),
+			wantNights:               7,
+			wantSubtotal:             800,
+			wantLengthOfStayDiscount: 80,
+			wantTotal:                720,
+		},
+		{
+			name:              "promo_code",
+			roomID:            "1",
+			startDate:         time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			endDate:           time.Date(2027, 3, 3, 0, 0, 0, 0, time.UTC),
+			promoCode:         "SPRING",
+			wantNights:        2,
+			wantSubtotal:      200,
+			wantPromoDiscount: 40,
+			wantTotal:         160,
+		},
+		{
+			name:                     "promo_code_after_length_of_stay_discount",
+			roomID:                   "1",
+			startDate:                time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			endDate:                  time.Date(2027, 3, 8, 0, 0, 0, 0, time.UTC),
+			promoCode:                "SPRING",
+			wantNights:               7,
+			wantSubtotal:             800,
+			wantLengthOfStayDiscount: 80,
+			wantPromoDiscount:        144,
+			wantTotal:                576,
+		},
+		{
+			name:         "shorter_than_one_night",
+			roomID:       "1",
+			startDate:    time.Date(2027, 3, 1, 10, 0, 0, 0, time.UTC),
+			endDate:      time.Date(2027, 3, 1, 18, 0, 0, 0, time.UTC),
+			wantNights:   1,
+			wantSubtotal: 100,
+			wantTotal:    100,
+		},
+		{
+			// nights are calendar days in UTC
+			name:         "time_zone",
+			roomID:       "1",
+			startDate:    time.Date(2027, 3, 1, 22, 0, 0, 0, time.FixedZone("EST", -5*60*60)),
+			endDate:      time.Date(2027, 3, 3, 22, 0, 0, 0, time.FixedZone("EST", -5*60*60)),
+			wantNights:   2,
+			wantSubtotal: 200,
+			wantTotal:    200,
+		},
+		{
+			name:      "end_before_start",
+			roomID:    "1",
+			startDate: time.Date(2027, 3, 3, 0, 0, 0, 0, time.UTC),
+			endDate:   time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantErr:   ErrInvalidBookingDates,
+		},
+		{
+			name:      "empty_stay",
+			roomID:    "1",
+			startDate: time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			endDate:   time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantErr:   ErrInvalidBookingDates,
+		},
+		{
+			name:      "unknown_promo_code",
+			roomID:    "1",
+			startDate: time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			endDate:   time.Date(2027, 3, 3, 0, 0, 0, 0, time.UTC),
+			promoCode: "WINTER",
+			wantErr:   ErrInvalidPromoCode,
+		},
+		{
+			name:                     "longest_stay",
+			roomID:                   "1",
+			startDate:                time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			endDate:                  time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+			wantNights:               365,
+			wantSubtotal:             43700,
+			wantLengthOfStayDiscount: 4370,
+			wantTotal:                39330,
+		},
+		{
+			name:      "stay_too_long",
+			roomID:    "1",
+			startDate: time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			endDate:   time.Date(2028, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantErr:   ErrStayTooLong,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			price, err := pricing.Price(tc.roomID, tc.startDate, tc.endDate, tc.promoCode)
+			if errors.Cause(err) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(price.Nights) != tc.wantNights {
+				t.Errorf("expected %d nights, got %d", tc.wantNights, len(price.Nights))
+			}
+			if price.Subtotal != tc.wantSubtotal {
+				t.Errorf("expected subtotal %d, got %d", tc.wantSubtotal, price.Subtotal)
+			}
+			if price.LengthOfStayDiscount != tc.wantLengthOfStayDiscount {
+				t.Errorf("expected length of stay discount %d, got %d", tc.wantLengthOfStayDiscount, price.LengthOfStayDiscount)
+			}
+			if price.PromoDiscount != tc.wantPromoDiscount {
+				t.Errorf("expected promo discount %d, got %d", tc.wantPromoDiscount, price.PromoDiscount)
+			}
+			if price.Total != tc.wantTotal {
+				t.Errorf("expected total %d, got %d", tc.wantTotal, price.Total)
+			}
+		})
+	}
+}
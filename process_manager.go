@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// processCommandNamespace is the namespace of UUIDs of commands sent by processes (see ProcessManager.commandUUID).
+var processCommandNamespace = uuid.MustParse("0b5f8a34-5c1e-4c0e-9a57-3f0c2f9d7a61")
+
+// ProcessState is the state of one instance of a process, it's saved in ProcessStore as JSON.
+type ProcessState interface {
+	// Deadline returns when the process times out, zero time means that the process doesn't wait for anything.
+	Deadline() time.Time
+}
+
+// ProcessStepFunc changes the state of the process by the event and returns commands which should be sent.
+// The event is nil when the step is called because the deadline of the process passed.
+type ProcessStepFunc func(ctx context.Context, state ProcessState, event interface{}) ([]interface{}, error)
+
+// ProcessManager coordinates a long running process (saga), which reacts to events by sending commands,
+// for example when a step fails permanently, it sends commands which are compensating the previous steps.
+//
+// Every instance of the process has its state in ProcessStore under its id (for example id of the reservation).
+// Event is handled in a transaction: the state is loaded, changed by the step and saved, and commands returned
+// by the step are stored in the outbox in the same transaction (the command bus must publish with OutboxPublisher),
+// so the state is never saved without its commands. UUIDs of the commands are derived from the id and
+// the version of the state, so when the event is handled again after a failure, the same commands are sent
+// and command handlers are skipping them (see IdempotencyMiddleware).
+//
+// The timeout step is called by RunTimeouts, when the deadline of the state passes.
+type ProcessManager struct {
+	name       string
+	db         *sql.DB
+	store      *ProcessStore
+	commandBus *cqrs.CommandBus
+	newState   func() ProcessState
+	timeout    ProcessStepFunc
+}
+
+func NewProcessManager(
+	name string,
+	db *sql.DB,
+	store *ProcessStore,
+	commandBus *cqrs.CommandBus,
+	newState func() ProcessState,
+	timeout ProcessStepFunc,
+) *ProcessManager {
+	return &ProcessManager{
+		name:       name,
+		db:         db,
+		store:      store,
+		commandBus: commandBus,
+		newState:   newState,
+		timeout:    timeout,
+	}
+}
+
+// StartOn returns event handler, which starts a new instance of the process with the event.
+// Redelivered event of the instance which already started is ignored.
+func (m *ProcessManager) StartOn(
+	newEvent func() interface{},
+	processID func(event interface{}) string,
+	step ProcessStepFunc,
+) cqrs.EventHandler {
+	return m.eventHandler(newEvent, processID, true, step)
+}
+
+// On returns event handler, which passes the event to the running instance of the process.
+// Events without process id (empty string) and events of instances which didn't start are ignored.
+func (m *ProcessManager) On(
+	newEvent func() interface{},
+	processID func(event interface{}) string,
+	step ProcessStepFunc,
+) cqrs.EventHandler {
+	return m.eventHandler(newEvent, processID, false, step)
+}
+
+func (m *ProcessManager) eventHandler(
+	newEvent func() interface{},
+	processID func(event interface{}) string,
+	start bool,
+	step ProcessStepFunc,
+) cqrs.EventHandler {
+	return eventHandler{
+		name:     m.name + "On" + cqrs.StructName(newEvent()),
+		newEvent: newEvent,
+		handle: func(ctx context.Context, event interface{}) error {
+			id := processID(event)
+			if id == "" {
+				return nil
+			}
+
+			return m.handle(ctx, id, func(ctx context.Context, state ProcessState, version int64) ([]interface{}, error) {
+				if start != (version == 0) {
+					return nil, nil
+				}
+
+				return step(ctx, state, event)
+			})
+		},
+	}
+}
+
+// RunTimeouts calls the timeout step of instances, which passed their deadline, with the given interval until ctx is done.
+func (m *ProcessManager) RunTimeouts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := m.handleTimeouts(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Cannot handle timeouts of %s process: %s", m.name, err)
+		}
+	}
+}
+
+func (m *ProcessManager) handleTimeouts(ctx context.Context) error {
+	now := time.Now()
+
+	timedOut, err := m.store.TimedOut(ctx, m.name, now)
+	if err != nil {
+		return err
+	}
+
+	for _, instance := range timedOut {
+		// commands sent by the timeout step belong to the flow which started the process
+		ctx := WithCorrelationID(ctx, instance.CorrelationID)
+
+		err := m.handle(ctx, instance.ID, func(ctx context.Context, state ProcessState, version int64) ([]interface{}, error) {
+			// the state may have changed since it was listed
+			deadline := state.Deadline()
+			if deadline.IsZero() || deadline.After(now) {
+				return nil, nil
+			}
+
+			return m.timeout(ctx, state, nil)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "cannot handle timeout of %s", instance.ID)
+		}
+	}
+
+	return nil
+}
+
+// handle loads the state of the instance, changes it with step and saves it with commands returned by step.
+// Nothing is saved when step returns no commands and doesn't change the state.
+func (m *ProcessManager) handle(
+	ctx context.Context,
+	id string,
+	step func(ctx context.Context, state ProcessState, version int64) ([]interface{}, error),
+) error {
+	return runInTx(ctx, m.db, func(ctx context.Context) error {
+		state := m.newState()
+		version, err := m.store.Load(ctx, m.name, id, state)
+		if err != nil {
+			return err
+		}
+
+		before, err := json.Marshal(state)
+		if err != nil {
+			return errors.Wrap(err, "cannot marshal process state")
+		}
+
+		commands, err := step(ctx, state, version)
+		if err != nil {
+			return err
+		}
+
+		after, err := json.Marshal(state)
+		if err != nil {
+			return errors.Wrap(err, "cannot marshal process state")
+		}
+		if len(commands) == 0 && string(before) == string(after) {
+			return nil
+		}
+
+		correlationID, _ := CorrelationID(ctx)
+		if err := m.store.Save(ctx, m.name, id, version, state, correlationID); err != nil {
+			return err
+		}
+
+		// commands are stored in the outbox in this transaction, OutboxRelay sends them after it's committed
+		for i, cmd := range commands {
+			if err := m.commandBus.Send(WithMessageUUID(ctx, m.commandUUID(id, version, i)), cmd); err != nil {
+				return errors.Wrapf(err, "cannot send command of %s process %s", m.name, id)
+			}
+		}
+
+		return nil
+	})
+}
+
+// commandUUID returns UUID of i-th command sent by the step, which changed the state from the version.
+func (m *ProcessManager) commandUUID(id string, version int64, i int) string {
+	return uuid.NewSHA1(processCommandNamespace, []byte(fmt.Sprintf("%s/%s/%d/%d", m.name, id, version, i))).String()
+}
+
+// TimedOutProcess is an instance of the process, which passed its deadline.
+type TimedOutProcess struct {
+	ID            string
+	CorrelationID string
+}
+
+// ProcessStore keeps states of all instances of processes in SQLite.
+// When ctx has a transaction (see runInTx), the state is loaded and saved in it.
+type ProcessStore struct {
+	db *sql.DB
+}
+
+func NewProcessStore(db *sql.DB) (*ProcessStore, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS processes (
+			process TEXT NOT NULL,
+			id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			state TEXT NOT NULL,
+			deadline TIMESTAMP,
+			correlation_id TEXT NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (process, id)
+		);
+		CREATE INDEX IF NOT EXISTS processes_deadline ON processes (process, deadline)`,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create processes table")
+	}
+
+	return &ProcessStore{db}, nil
+}
+
+// Load unmarshals the state of the instance into state and returns its version.
+// When the instance didn't start yet, 0 is returned.
+func (s *ProcessStore) Load(ctx context.Context, process string, id string, state ProcessState) (int64, error) {
+	var version int64
+
+	err := runInTx(ctx, s.db, func(ctx context.Context) error {
+		tx, _ := txFromContext(ctx)
+
+		var b string
+		err := tx.QueryRowContext(
+			ctx,
+			`SELECT version, state FROM processes WHERE process = ? AND id = ?`,
+			process, id,
+		).Scan(&version, &b)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "cannot load %s process %s", process, id)
+		}
+
+		return errors.Wrapf(json.Unmarshal([]byte(b), state), "cannot unmarshal %s process %s", process, id)
+	})
+
+	return version, err
+}
+
+// Save stores the state of the instance, which was loaded with expectedVersion.
+// ErrConcurrencyConflict is returned when the state was saved by someone else in the meantime.
+func (s *ProcessStore) Save(
+	ctx context.Context,
+	process string,
+	id string,
+	expectedVersion int64,
+	state ProcessState,
+	correlationID string,
+) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal process state")
+	}
+
+	var deadline *time.Time
+	if d := state.Deadline(); !d.IsZero() {
+		d = d.UTC()
+		deadline = &d
+	}
+
+	return runInTx(ctx, s.db, func(ctx context.Context) error {
+		tx, _ := txFromContext(ctx)
+
+		result, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO processes (process, id, version, state, deadline, correlation_id, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (process, id) DO UPDATE SET
+				version = excluded.version, state = excluded.state, deadline = excluded.deadline, updated_at = excluded.updated_at
+			WHERE processes.version = ?`,
+			process, id, expectedVersion+1, string(b), deadline, correlationID, time.Now().UTC(), expectedVersion,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "cannot save %s process %s", process, id)
+		}
+
+		saved, err := result.RowsAffected()
+		if err != nil {
+			return errors.Wrapf(err, "cannot save %s process %s", process, id)
+		}
+		if saved == 0 {
+			return errors.Wrapf(ErrConcurrencyConflict, "%s process %s was modified, expected version %d", process, id, expectedVersion)
+		}
+
+		return nil
+	})
+}
+
+// TimedOut returns instances of the process with deadline before now.
+func (s *ProcessStore) TimedOut(ctx context.Context, process string, now time.Time) ([]TimedOutProcess, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT id, correlation_id FROM processes WHERE process = ? AND deadline IS NOT NULL AND deadline <= ? ORDER BY deadline`,
+		process, now.UTC(),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot query timed out %s processes", process)
+	}
+	defer rows.Close()
+
+	var timedOut []TimedOutProcess
+	for rows.Next() {
+		var p TimedOutProcess
+		if err := rows.Scan(&p.ID, &p.CorrelationID); err != nil {
+			return nil, errors.Wrapf(err, "cannot scan timed out %s process", process)
+		}
+		timedOut = append(timedOut, p)
+	}
+
+	return timedOut, errors.Wrapf(rows.Err(), "cannot query timed out %s processes", process)
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ProjectionStore persists state of read models, so they survive restarts.
+// Small state is stored as a whole under the name of the projection (Save),
+// projections with many items (like reservations) are stored by items, so only the changed item is saved (SaveItem).
+// SaveWithItem saves both at once, for example the state with the key of the applied event.
+type ProjectionStore interface {
+	// Load unmarshals saved state of the projection into state.
+	// When the projection was never saved, false is returned and state is not modified.
+	Load(ctx context.Context, projection string, state interface{}) (bool, error)
+
+	// Save replaces the saved state of the projection.
+	Save(ctx context.Context, projection string, state interface{}) error
+
+	// LoadItems unmarshals all saved items of the projection into items, which must be a pointer to a map by item id.
+	LoadItems(ctx context.Context, projection string, items interface{}) error
+
+	// SaveItem replaces the saved item of the projection.
+	SaveItem(ctx context.Context, projection string, id string, item interface{}) error
+
+	// HasItem returns true when the item of the projection is saved.
+	HasItem(ctx context.Context, projection string, id string) (bool, error)
+
+	// SaveWithItem saves the state of the projection and the item of itemProjection atomically,
+	// so one of them is never saved without the other.
+	SaveWithItem(ctx context.Context, projection string, state interface{}, itemProjection string, id string, item interface{}) error
+
+	// Close flushes and closes the store, it's called when the service is stopped.
+	Close() error
+}
+
+// NewProjectionStore creates ProjectionStore of the given kind: "memory", "sqlite" or "bolt".
+func NewProjectionStore(kind string, db *sql.DB, boltPath string) (ProjectionStore, error) {
+	switch kind {
+	case "memory":
+		return NewMemoryProjectionStore(), nil
+	case "sqlite":
+		return NewSQLiteProjectionStore(db)
+	case "bolt":
+		return NewBoltProjectionStore(boltPath)
+	default:
+		return nil, errors.Errorf("unknown projection store %q", kind)
+	}
+}
+
+// MemoryProjectionStore keeps projections only in memory, it is useful for development and tests.
+type MemoryProjectionStore struct {
+	projections map[string][]byte
+	items       map[string]map[string]json.RawMessage
+	lock        sync.RWMutex
+}
+
+func NewMemoryProjectionStore() *MemoryProjectionStore {
+	return &MemoryProjectionStore{
+		projections: map[string][]byte{},
+		items:       map[string]map[string]json.RawMessage{},
+	}
+}
+
+func (s *MemoryProjectionStore) Load(ctx context.Context, projection string, state interface{}) (bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	b, ok := s.projections[projection]
+	if !ok {
+		return false, nil
+	}
+
+	return true, unmarshalProjection(projection, b, state)
+}
+
+func (s *MemoryProjectionStore) Save(ctx context.Context, projection string, state interface{}) error {
+	b, err := marshalProjection(projection, state)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.projections[projection] = b
+	return nil
+}
+
+func (s *MemoryProjectionStore) LoadItems(ctx context.Context, projection string, items interface{}) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return unmarshalProjectionItems(projection, s.items[projection], items)
+}
+
+func (s *MemoryProjectionStore) SaveItem(ctx context.Context, projection string, id string, item interface{}) error {
+	b, err := marshalProjection(projection, item)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.putItem(projection, id, b)
+	return nil
+}
+
+func (s *MemoryProjectionStore) HasItem(ctx context.Context, projection string, id string) (bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	_, ok := s.items[projection][id]
+	return ok, nil
+}
+
+func (s *MemoryProjectionStore) SaveWithItem(
+	ctx context.Context,
+	projection string,
+	state interface{},
+	itemProjection string,
+	id string,
+	item interface{},
+) error {
+	stateBytes, err := marshalProjection(projection, state)
+	if err != nil {
+		return err
+	}
+	itemBytes, err := marshalProjection(itemProjection, item)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.projections[projection] = stateBytes
+	s.putItem(itemProjection, id, itemBytes)
+	return nil
+}
+
+func (s *MemoryProjectionStore) putItem(projection string, id string, b []byte) {
+	if s.items[projection] == nil {
+		s.items[projection] = map[string]json.RawMessage{}
+	}
+	s.items[projection][id] = b
+}
+
+func (s *MemoryProjectionStore) Close() error {
+	return nil
+}
+
+const (
+	saveProjectionQuery = `INSERT INTO projections (name, state) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET state = excluded.state`
+	saveProjectionItemQuery = `INSERT INTO projection_items (projection, id, state) VALUES (?, ?, ?)
+		ON CONFLICT (projection, id) DO UPDATE SET state = excluded.state`
+)
+
+// SQLiteProjectionStore keeps projections in the same database as events.
+type SQLiteProjectionStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteProjectionStore(db *sql.DB) (*SQLiteProjectionStore, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS projections (
+			name TEXT PRIMARY KEY,
+			state TEXT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS projection_items (
+			projection TEXT NOT NULL,
+			id TEXT NOT NULL,
+			state TEXT NOT NULL,
+			PRIMARY KEY (projection, id)
+		)`,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create projections table")
+	}
+
+	return &SQLiteProjectionStore{db}, nil
+}
+
+func (s *SQLiteProjectionStore) Load(ctx context.Context, projection string, state interface{}) (bool, error) {
+	var b string
+
+	err := s.db.QueryRowContext(ctx, `SELECT state FROM projections WHERE name = ?`, projection).Scan(&b)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "cannot load projection %s", projection)
+	}
+
+	return true, unmarshalProjection(projection, []byte(b), state)
+}
+
+func (s *SQLiteProjectionStore) Save(ctx context.Context, projection string, state interface{}) error {
+	b, err := marshalProjection(projection, state)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, saveProjectionQuery, projection, string(b))
+	return errors.Wrapf(err, "cannot save projection %s", projection)
+}
+
+func (s *SQLiteProjectionStore) LoadItems(ctx context.Context, projection string, items interface{}) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, state FROM projection_items WHERE projection = ?`, projection)
+	if err != nil {
+		return errors.Wrapf(err, "cannot load items of projection %s", projection)
+	}
+	defer rows.Close()
+
+	states := map[string]json.RawMessage{}
+	for rows.Next() {
+		var id, state string
+		if err := rows.Scan(&id, &state); err != nil {
+			return errors.Wrapf(err, "cannot scan item of projection %s", projection)
+		}
+		states[id] = json.RawMessage(state)
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrapf(err, "cannot iterate items of projection %s", projection)
+	}
+
+	return unmarshalProjectionItems(projection, states, items)
+}
+
+func (s *SQLiteProjectionStore) SaveItem(ctx context.Context, projection string, id string, item interface{}) error {
+	b, err := marshalProjection(projection, item)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, saveProjectionItemQuery, projection, id, string(b))
+	return errors.Wrapf(err, "cannot save item %s of projection %s", id, projection)
+}
+
+func (s *SQLiteProjectionStore) HasItem(ctx context.Context, projection string, id string) (bool, error) {
+	var found int
+
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT 1 FROM projection_items WHERE projection = ? AND id = ?`,
+		projection, id,
+	).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "cannot check item %s of projection %s", id, projection)
+	}
+
+	return true, nil
+}
+
+func (s *SQLiteProjectionStore) SaveWithItem(
+	ctx context.Context,
+	projection string,
+	state interface{},
+	itemProjection string,
+	id string,
+	item interface{},
+) error {
+	stateBytes, err := marshalProjection(projection, state)
+	if err != nil {
+		return err
+	}
+	itemBytes, err := marshalProjection(itemProjection, item)
+	if err != nil {
+		return err
+	}
+
+	return runInTx(ctx, s.db, func(ctx context.Context) error {
+		tx, _ := txFromContext(ctx)
+
+		if _, err := tx.ExecContext(ctx, saveProjectionQuery, projection, string(stateBytes)); err != nil {
+			return errors.Wrapf(err, "cannot save projection %s", projection)
+		}
+
+		_, err := tx.ExecContext(ctx, saveProjectionItemQuery, itemProjection, id, string(itemBytes))
+		return errors.Wrapf(err, "cannot save item %s of projection %s", id, itemProjection)
+	})
+}
+
+// Close does nothing, the database is shared with the event store, so it's closed by its owner.
+func (s *SQLiteProjectionStore) Close() error {
+	return nil
+}
+
+var (
+	boltProjectionsBucket = []byte("projections")
+	// items of every projection are in a nested bucket named after the projection
+	boltProjectionItemsBucket = []byte("projection_items")
+)
+
+// BoltProjectionStore keeps projections in a BoltDB file, it doesn't need any database server.
+type BoltProjectionStore struct {
+	db *bolt.DB
+}
+
+func NewBoltProjectionStore(path string) (*BoltProjectionStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open %s", path)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(boltProjectionsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(boltProjectionItemsBucket)
+		return err
+	}); err != nil {
+		return nil, errors.Wrap(err, "cannot create projections buckets")
+	}
+
+	return &BoltProjectionStore{db}, nil
+}
+
+func (s *BoltProjectionStore) Load(ctx context.Context, projection string, state interface{}) (bool, error) {
+	var found bool
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltProjectionsBucket).Get([]byte(projection))
+		if b == nil {
+			return nil
+		}
+
+		found = true
+		return unmarshalProjection(projection, b, state)
+	})
+
+	return found, err
+}
+
+func (s *BoltProjectionStore) Save(ctx context.Context, projection string, state interface{}) error {
+	b, err := marshalProjection(projection, state)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltProjectionsBucket).Put([]byte(projection), b)
+	})
+}
+
+func (s *BoltProjectionStore) LoadItems(ctx context.Context, projection string, items interface{}) error {
+	states := map[string]json.RawMessage{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltProjectionItemsBucket).Bucket([]byte(projection))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(id, state []byte) error {
+			// values are valid only during the transaction
+			states[string(id)] = append(json.RawMessage(nil), state...)
+			return nil
+		})
+	})
+	if err != nil {
+		return errors.Wrapf(err, "cannot load items of projection %s", projection)
+	}
+
+	return unmarshalProjectionItems(projection, states, items)
+}
+
+func (s *BoltProjectionStore) SaveItem(ctx context.Context, projection string, id string, item interface{}) error {
+	b, err := marshalProjection(projection, item)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putBoltProjectionItem(tx, projection, id, b)
+	})
+}
+
+func (s *BoltProjectionStore) HasItem(ctx context.Context, projection string, id string) (bool, error) {
+	var found bool
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltProjectionItemsBucket).Bucket([]byte(projection))
+		found = bucket != nil && bucket.Get([]byte(id)) != nil
+		return nil
+	})
+
+	return found, err
+}
+
+func (s *BoltProjectionStore) SaveWithItem(
+	ctx context.Context,
+	projection string,
+	state interface{},
+	itemProjection string,
+	id string,
+	item interface{},
+) error {
+	stateBytes, err := marshalProjection(projection, state)
+	if err != nil {
+		return err
+	}
+	itemBytes, err := marshalProjection(itemProjection, item)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(boltProjectionsBucket).Put([]byte(projection), stateBytes); err != nil {
+			return err
+		}
+
+		return putBoltProjectionItem(tx, itemProjection, id, itemBytes)
+	})
+}
+
+func putBoltProjectionItem(tx *bolt.Tx, projection string, id string, b []byte) error {
+	bucket, err := tx.Bucket(boltProjectionItemsBucket).CreateBucketIfNotExists([]byte(projection))
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put([]byte(id), b)
+}
+
+func (s *BoltProjectionStore) Close() error {
+	return s.db.Close()
+}
+
+func marshalProjection(projection string, state interface{}) ([]byte, error) {
+	b, err := json.Marshal(state)
+	return b, errors.Wrapf(err, "cannot marshal projection %s", projection)
+}
+
+func unmarshalProjection(projection string, b []byte, state interface{}) error {
+	return errors.Wrapf(json.Unmarshal(b, state), "cannot unmarshal projection %s", projection)
+}
+
+// unmarshalProjectionItems unmarshals items saved by their ids into items, which must be a pointer to a map by id.
+func unmarshalProjectionItems(projection string, states map[string]json.RawMessage, items interface{}) error {
+	if len(states) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(states)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal items of projection %s", projection)
+	}
+
+	return unmarshalProjection(projection, b, items)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+type messageUUIDCtxKey struct{}
+
+// WithMessageUUID sets UUID of the message sent with this context by cqrs.CommandBus or cqrs.EventBus,
+// so the sender knows the id of the command before it's handled.
+func WithMessageUUID(ctx context.Context, uuid string) context.Context {
+	return context.WithValue(ctx, messageUUIDCtxKey{}, uuid)
+}
+
+// MessageUUIDPublisher is message.Publisher decorator, which replaces UUID generated by the marshaler
+// with UUID from the message context (see WithMessageUUID).
+type MessageUUIDPublisher struct {
+	publisher message.Publisher
+}
+
+func NewMessageUUIDPublisher(publisher message.Publisher) MessageUUIDPublisher {
+	return MessageUUIDPublisher{publisher}
+}
+
+func (p MessageUUIDPublisher) Publish(topic string, messages ...*message.Message) error {
+	for _, msg := range messages {
+		if uuid, ok := msg.Context().Value(messageUUIDCtxKey{}).(string); ok {
+			msg.UUID = uuid
+		}
+	}
+
+	return p.publisher.Publish(topic, messages...)
+}
+
+func (p MessageUUIDPublisher) Close() error {
+	return p.publisher.Close()
+}
+
+type handledMessageUUIDCtxKey struct{}
+
+// HandledMessageUUIDMiddleware is router middleware, which sets UUID of the handled message in its context.
+// cqrs handlers are receiving only the unmarshaled payload, so they can read the UUID with HandledMessageUUID.
+func HandledMessageUUIDMiddleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		msg.SetContext(context.WithValue(msg.Context(), handledMessageUUIDCtxKey{}, msg.UUID))
+		return h(msg)
+	}
+}
+
+// HandledMessageUUID returns UUID of the message handled with this context (see HandledMessageUUIDMiddleware).
+func HandledMessageUUID(ctx context.Context) (string, bool) {
+	uuid, ok := ctx.Value(handledMessageUUIDCtxKey{}).(string)
+	return uuid, ok
+}
+
+// TopicPublisher is message.Publisher, which publishes messages of the events topic with the events publisher
+// and messages of all other topics (commands) with the commands publisher.
+// It's used by OutboxRelay, because the outbox has both events and commands sent by processes.
+type TopicPublisher struct {
+	eventsTopic       string
+	eventsPublisher   message.Publisher
+	commandsPublisher message.Publisher
+}
+
+func NewTopicPublisher(eventsTopic string, eventsPublisher, commandsPublisher message.Publisher) TopicPublisher {
+	return TopicPublisher{eventsTopic, eventsPublisher, commandsPublisher}
+}
+
+func (p TopicPublisher) Publish(topic string, messages ...*message.Message) error {
+	if topic == p.eventsTopic {
+		return p.eventsPublisher.Publish(topic, messages...)
+	}
+
+	return p.commandsPublisher.Publish(topic, messages...)
+}
+
+// Close doesn't close the publishers, they are closed by their owner.
+func (p TopicPublisher) Close() error {
+	return nil
+}
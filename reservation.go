@@ -0,0 +1,341 @@
+package main
+
+import (
+	"main.go/events"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	ErrReservationCancelled = errors.New("reservation is cancelled")
+	ErrAlreadyCheckedIn     = errors.New("guest already checked in")
+	ErrAlreadyCheckedOut    = errors.New("guest already checked out")
+	ErrNotCheckedIn         = errors.New("guest didn't check in yet")
+	ErrCheckInOutsideStay   = errors.New("check-in is possible only between start and end date of the booking")
+)
+
+type ReservationStatus string
+
+const (
+	ReservationBooked     ReservationStatus = "booked"
+	ReservationCheckedIn  ReservationStatus = "checked_in"
+	ReservationCheckedOut ReservationStatus = "checked_out"
+	ReservationCancelled  ReservationStatus = "cancelled"
+)
+
+// Reservation is an event sourced aggregate.
+//
+// Its state is never modified directly: command methods (like Cancel) are checking business rules
+// and record events, which are applied to the state. When reservation is loaded, the same events are replayed.
+type Reservation struct {
+	id           string
+	roomID       string
+	guestName    string
+	startDate    time.Time
+	endDate      time.Time
+	price        int64
+	status       ReservationStatus
+	checkedInAt  time.Time
+	checkedOutAt time.Time
+	// credit is the sum of all credits applied to the reservation
+	credit int64
+	// promoCode is kept, so the modified booking is discounted the same way
+	promoCode string
+
+	// version is version of the event stream from which reservation was loaded
+	version int64
+	// changes are recorded events which were not saved yet
+	changes []proto.Message
+}
+
+// NewReservation books a new reservation, price is calculated by Pricing.
+func NewReservation(
+	id, roomID, guestName string,
+	startDate, endDate time.Time,
+	price *events.PriceBreakdown,
+) (*Reservation, error) {
+	if !startDate.Before(endDate) {
+		return nil, ErrInvalidBookingDates
+	}
+	if price.Total < 0 {
+		return nil, errors.Errorf("price cannot be negative, got %d", price.Total)
+	}
+
+	r := &Reservation{}
+	r.record(&events.RoomBooked{
+		ReservationId:  id,
+		RoomId:         roomID,
+		GuestName:      guestName,
+		Price:          price.Total,
+		StartDate:      timestamppb.New(startDate),
+		EndDate:        timestamppb.New(endDate),
+		PriceBreakdown: price,
+	})
+
+	return r, nil
+}
+
+func (r *Reservation) ID() string {
+	return r.id
+}
+
+func (r *Reservation) RoomID() string {
+	return r.roomID
+}
+
+func (r *Reservation) GuestName() string {
+	return r.guestName
+}
+
+func (r *Reservation) StartDate() time.Time {
+	return r.startDate
+}
+
+func (r *Reservation) EndDate() time.Time {
+	return r.endDate
+}
+
+func (r *Reservation) Price() int64 {
+	return r.price
+}
+
+func (r *Reservation) PromoCode() string {
+	return r.promoCode
+}
+
+func (r *Reservation) Status() ReservationStatus {
+	return r.status
+}
+
+func (r *Reservation) Credit() int64 {
+	return r.credit
+}
+
+// Modify changes room, dates and price of the booking, price is recalculated by Pricing.
+// Booking can't be modified once the guest checked in. modificationID identifies the change in BookingModified.
+func (r *Reservation) Modify(
+	modificationID, roomID string,
+	startDate, endDate time.Time,
+	price *events.PriceBreakdown,
+) error {
+	if err := r.checkNotCheckedInOrCancelled(); err != nil {
+		return err
+	}
+	if !startDate.Before(endDate) {
+		return ErrInvalidBookingDates
+	}
+	if price.Total < 0 {
+		return errors.Errorf("price cannot be negative, got %d", price.Total)
+	}
+
+	r.record(&events.BookingModified{
+		ReservationId:  r.id,
+		RoomId:         roomID,
+		Price:          price.Total,
+		StartDate:      timestamppb.New(startDate),
+		EndDate:        timestamppb.New(endDate),
+		OldRoomId:      r.roomID,
+		OldPrice:       r.price,
+		OldStartDate:   timestamppb.New(r.startDate),
+		OldEndDate:     timestamppb.New(r.endDate),
+		PriceDelta:     price.Total - r.price,
+		PriceBreakdown: price,
+		ModificationId: modificationID,
+	})
+
+	return nil
+}
+
+// CheckIn checks the guest in, it is possible only during the booked stay.
+func (r *Reservation) CheckIn(at time.Time) error {
+	if err := r.checkNotCheckedInOrCancelled(); err != nil {
+		return err
+	}
+	if at.Before(r.startDate) || !at.Before(r.endDate) {
+		return ErrCheckInOutsideStay
+	}
+
+	r.record(&events.GuestCheckedIn{
+		ReservationId: r.id,
+		RoomId:        r.roomID,
+		CheckedInAt:   timestamppb.New(at),
+		GuestName:     r.guestName,
+	})
+
+	return nil
+}
+
+// CheckOut checks the guest out, it is possible only after check-in (also before the end of the stay).
+func (r *Reservation) CheckOut(at time.Time) error {
+	switch r.status {
+	case ReservationCheckedIn:
+	case ReservationCheckedOut:
+		return ErrAlreadyCheckedOut
+	case ReservationCancelled:
+		return ErrReservationCancelled
+	default:
+		return ErrNotCheckedIn
+	}
+
+	r.record(&events.GuestCheckedOut{
+		ReservationId: r.id,
+		RoomId:        r.roomID,
+		CheckedOutAt:  timestamppb.New(at),
+	})
+
+	return nil
+}
+
+// ApplyCredit credits the guest, for example as a compensation. creditID identifies the credit in CreditApplied.
+func (r *Reservation) ApplyCredit(creditID string, amount int64, reason string) error {
+	if r.status == ReservationCancelled {
+		return ErrReservationCancelled
+	}
+	if amount < 1 {
+		return errors.Errorf("credit must be positive, got %d", amount)
+	}
+
+	r.record(&events.CreditApplied{
+		ReservationId: r.id,
+		RoomId:        r.roomID,
+		Amount:        amount,
+		Reason:        reason,
+		CreditId:      creditID,
+	})
+
+	return nil
+}
+
+// Cancel cancels the booking and returns amount refunded to the guest.
+// Bookings cancelled before the stay are refunded fully, there is no refund once the stay has started.
+func (r *Reservation) Cancel(at time.Time) (int64, error) {
+	if err := r.checkNotCheckedInOrCancelled(); err != nil {
+		return 0, err
+	}
+
+	var refund int64
+	if at.Before(r.startDate) {
+		refund = r.price
+	}
+
+	r.record(&events.BookingCancelled{
+		ReservationId: r.id,
+		RoomId:        r.roomID,
+		RefundAmount:  refund,
+	})
+
+	return refund, nil
+}
+
+func (r *Reservation) checkNotCheckedInOrCancelled() error {
+	switch r.status {
+	case ReservationCancelled:
+		return ErrReservationCancelled
+	case ReservationCheckedIn:
+		return ErrAlreadyCheckedIn
+	case ReservationCheckedOut:
+		return ErrAlreadyCheckedOut
+	default:
+		return nil
+	}
+}
+
+func (r *Reservation) record(event proto.Message) {
+	r.apply(event)
+	r.changes = append(r.changes, event)
+}
+
+// apply changes the state according to the event, it must not check any business rules:
+// the event already happened.
+func (r *Reservation) apply(event proto.Message) {
+	switch e := event.(type) {
+	case *events.RoomBooked:
+		r.id = e.ReservationId
+		r.roomID = e.RoomId
+		r.guestName = e.GuestName
+		r.price = e.Price
+		r.promoCode = e.PriceBreakdown.GetPromoCode()
+		r.startDate = e.StartDate.AsTime()
+		r.endDate = e.EndDate.AsTime()
+		r.status = ReservationBooked
+	case *events.BookingModified:
+		r.roomID = e.RoomId
+		r.price = e.Price
+		if e.PriceBreakdown != nil {
+			r.promoCode = e.PriceBreakdown.PromoCode
+		}
+		r.startDate = e.StartDate.AsTime()
+		r.endDate = e.EndDate.AsTime()
+	case *events.GuestCheckedIn:
+		r.status = ReservationCheckedIn
+		r.checkedInAt = e.CheckedInAt.AsTime()
+	case *events.GuestCheckedOut:
+		r.status = ReservationCheckedOut
+		r.checkedOutAt = e.CheckedOutAt.AsTime()
+	case *events.CreditApplied:
+		r.credit += e.Amount
+	case *events.BookingCancelled:
+		r.status = ReservationCancelled
+	}
+}
+
+// reservationEvents are all events which can be applied to Reservation.
+var reservationEvents = []proto.Message{
+	&events.RoomBooked{},
+	&events.BookingModified{},
+	&events.GuestCheckedIn{},
+	&events.GuestCheckedOut{},
+	&events.CreditApplied{},
+	&events.BookingCancelled{},
+}
+
+// reservationSnapshot is the state of Reservation saved in the snapshot.
+type reservationSnapshot struct {
+	ID           string            `json:"id"`
+	RoomID       string            `json:"room_id"`
+	GuestName    string            `json:"guest_name"`
+	StartDate    time.Time         `json:"start_date"`
+	EndDate      time.Time         `json:"end_date"`
+	Price        int64             `json:"price"`
+	PromoCode    string            `json:"promo_code,omitempty"`
+	Status       ReservationStatus `json:"status"`
+	CheckedInAt  time.Time         `json:"checked_in_at"`
+	CheckedOutAt time.Time         `json:"checked_out_at"`
+	Credit       int64             `json:"credit"`
+}
+
+func (r *Reservation) snapshot() reservationSnapshot {
+	return reservationSnapshot{
+		ID:           r.id,
+		RoomID:       r.roomID,
+		GuestName:    r.guestName,
+		StartDate:    r.startDate,
+		EndDate:      r.endDate,
+		Price:        r.price,
+		PromoCode:    r.promoCode,
+		Status:       r.status,
+		CheckedInAt:  r.checkedInAt,
+		CheckedOutAt: r.checkedOutAt,
+		Credit:       r.credit,
+	}
+}
+
+func reservationFromSnapshot(s reservationSnapshot, version int64) *Reservation {
+	return &Reservation{
+		id:           s.ID,
+		roomID:       s.RoomID,
+		guestName:    s.GuestName,
+		startDate:    s.StartDate,
+		endDate:      s.EndDate,
+		price:        s.Price,
+		promoCode:    s.PromoCode,
+		status:       s.Status,
+		checkedInAt:  s.CheckedInAt,
+		checkedOutAt: s.CheckedOutAt,
+		credit:       s.Credit,
+		version:      version,
+	}
+}
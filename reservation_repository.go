@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// reservationSnapshotInterval is the number of events after which a new snapshot of Reservation is saved.
+const reservationSnapshotInterval = 10
+
+// ReservationRepository loads Reservation aggregate from EventStore and saves its new events.
+type ReservationRepository struct {
+	eventSourcedRepository
+}
+
+func NewReservationRepository(
+	db *sql.DB,
+	eventStore EventStore,
+	snapshots SnapshotStore,
+	eventBus *cqrs.EventBus,
+	marshaler cqrs.CommandEventMarshaler,
+) *ReservationRepository {
+	return &ReservationRepository{eventSourcedRepository{
+		db:               db,
+		eventStore:       eventStore,
+		snapshots:        snapshots,
+		eventBus:         eventBus,
+		marshaler:        marshaler,
+		snapshotInterval: reservationSnapshotInterval,
+	}}
+}
+
+// Load rebuilds Reservation from the latest snapshot and events recorded after it.
+// ErrReservationNotFound is returned when there are no events of the reservation.
+func (r *ReservationRepository) Load(ctx context.Context, reservationID string) (*Reservation, error) {
+	var snapshot reservationSnapshot
+	reservation := &Reservation{}
+
+	found, err := r.load(
+		ctx,
+		reservationStreamID(reservationID),
+		&snapshot,
+		reservationEvents,
+		func(version int64) {
+			reservation = reservationFromSnapshot(snapshot, version)
+		},
+		func(event proto.Message, version int64) {
+			reservation.apply(event)
+			reservation.version = version
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.Wrap(ErrReservationNotFound, reservationID)
+	}
+
+	return reservation, nil
+}
+
+// Save publishes events recorded by the reservation.
+// ErrConcurrencyConflict is returned when reservation was modified after it was loaded.
+func (r *ReservationRepository) Save(ctx context.Context, reservation *Reservation) error {
+	version, err := r.save(
+		ctx,
+		reservationStreamID(reservation.ID()),
+		reservation.version,
+		reservation.changes,
+		func() interface{} { return reservation.snapshot() },
+	)
+	if err != nil {
+		return err
+	}
+
+	reservation.version = version
+	reservation.changes = nil
+
+	return nil
+}
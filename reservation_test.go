@@ -0,0 +1,235 @@
+package main
+
+import (
+	"main.go/events"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestNewReservation(t *testing.T) {
+	march10 := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+	march15 := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	r, err := NewReservation("1", "101", "John", march10, march15, &events.PriceBreakdown{Total: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status() != ReservationBooked || r.RoomID() != "101" || r.Price() != 500 {
+		t.Errorf("expected booked room 101 for $500, got %s room %s for $%d", r.Status(), r.RoomID(), r.Price())
+	}
+	if len(r.changes) != 1 {
+		t.Errorf("expected RoomBooked to be recorded, got %d events", len(r.changes))
+	}
+
+	if _, err := NewReservation("2", "101", "John", march10, march10, &events.PriceBreakdown{Total: 500}); errors.Cause(err) != ErrInvalidBookingDates {
+		t.Errorf("expected ErrInvalidBookingDates, got %v", err)
+	}
+	if _, err := NewReservation("3", "101", "John", march10, march15, &events.PriceBreakdown{Total: -1}); err == nil {
+		t.Error("expected error for negative price")
+	}
+}
+
+func TestReservation_Cancel(t *testing.T) {
+	march10 := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+	march15 := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	r, err := NewReservation("1", "101", "John", march10, march15, &events.PriceBreakdown{Total: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refund, err := r.Cancel(march10.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund != 500 {
+		t.Errorf("booking cancelled before the stay should be refunded fully, got refund %d", refund)
+	}
+	if r.Status() != ReservationCancelled {
+		t.Errorf("expected status %s, got %s", ReservationCancelled, r.Status())
+	}
+
+	if _, err := r.Cancel(march10.Add(-time.Hour)); errors.Cause(err) != ErrReservationCancelled {
+		t.Errorf("expected ErrReservationCancelled, got %v", err)
+	}
+}
+
+func TestReservation_Cancel_stayStarted(t *testing.T) {
+	march10 := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+	march15 := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	r, err := NewReservation("1", "101", "John", march10, march15, &events.PriceBreakdown{Total: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refund, err := r.Cancel(march10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund != 0 {
+		t.Errorf("booking cancelled once the stay started should not be refunded, got refund %d", refund)
+	}
+}
+
+func TestReservation_snapshot(t *testing.T) {
+	march10 := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+	march15 := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	r, err := NewReservation("1", "101", "John", march10, march15, &events.PriceBreakdown{Total: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Cancel(march10); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := reservationFromSnapshot(r.snapshot(), 2)
+	if restored.snapshot() != r.snapshot() {
+		t.Errorf("expected %+v, got %+v", r.snapshot(), restored.snapshot())
+	}
+	if _, err := restored.Cancel(march10); errors.Cause(err) != ErrReservationCancelled {
+		t.Errorf("restored reservation should stay cancelled, got %v", err)
+	}
+}
+
+func TestReservation_CheckIn(t *testing.T) {
+	march10 := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+	march15 := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	r, err := NewReservation("1", "101", "John", march10, march15, &events.PriceBreakdown{Total: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.CheckIn(march10.Add(-time.Second)); errors.Cause(err) != ErrCheckInOutsideStay {
+		t.Errorf("expected ErrCheckInOutsideStay before the stay, got %v", err)
+	}
+	if err := r.CheckIn(march15); errors.Cause(err) != ErrCheckInOutsideStay {
+		t.Errorf("expected ErrCheckInOutsideStay after the stay, got %v", err)
+	}
+	if err := r.CheckOut(march15); errors.Cause(err) != ErrNotCheckedIn {
+		t.Errorf("expected ErrNotCheckedIn, got %v", err)
+	}
+
+	if err := r.CheckIn(march10.Add(14 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if r.Status() != ReservationCheckedIn {
+		t.Errorf("expected status %s, got %s", ReservationCheckedIn, r.Status())
+	}
+	if err := r.CheckIn(march10.Add(15 * time.Hour)); errors.Cause(err) != ErrAlreadyCheckedIn {
+		t.Errorf("expected ErrAlreadyCheckedIn, got %v", err)
+	}
+	if _, err := r.Cancel(march10.Add(15 * time.Hour)); errors.Cause(err) != ErrAlreadyCheckedIn {
+		t.Errorf("checked in reservation should not be cancelled, got %v", err)
+	}
+}
+
+func TestReservation_CheckOut(t *testing.T) {
+	march10 := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+	march15 := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	r, err := NewReservation("1", "101", "John", march10, march15, &events.PriceBreakdown{Total: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CheckIn(march10.Add(14 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.CheckOut(march15.Add(10 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if r.Status() != ReservationCheckedOut {
+		t.Errorf("expected status %s, got %s", ReservationCheckedOut, r.Status())
+	}
+
+	if err := r.CheckOut(march15.Add(11 * time.Hour)); errors.Cause(err) != ErrAlreadyCheckedOut {
+		t.Errorf("expected ErrAlreadyCheckedOut, got %v", err)
+	}
+	if err := r.CheckIn(march10.Add(14 * time.Hour)); errors.Cause(err) != ErrAlreadyCheckedOut {
+		t.Errorf("expected ErrAlreadyCheckedOut, got %v", err)
+	}
+}
+
+func TestReservation_CheckOut_cancelled(t *testing.T) {
+	march10 := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+	march15 := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	r, err := NewReservation("1", "101", "John", march10, march15, &events.PriceBreakdown{Total: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Cancel(march10.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.CheckIn(march10.Add(14 * time.Hour)); errors.Cause(err) != ErrReservationCancelled {
+		t.Errorf("expected ErrReservationCancelled, got %v", err)
+	}
+	if err := r.CheckOut(march15); errors.Cause(err) != ErrReservationCancelled {
+		t.Errorf("expected ErrReservationCancelled, got %v", err)
+	}
+}
+
+func TestReservation_Modify(t *testing.T) {
+	march10 := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+	march11 := time.Date(2027, 3, 11, 0, 0, 0, 0, time.UTC)
+	march13 := time.Date(2027, 3, 13, 0, 0, 0, 0, time.UTC)
+	march15 := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	r, err := NewReservation("1", "101", "John", march10, march15, &events.PriceBreakdown{Total: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.changes = nil
+
+	if err := r.Modify("modification-1", "102", march11, march13, &events.PriceBreakdown{Total: 200}); err != nil {
+		t.Fatal(err)
+	}
+	if r.RoomID() != "102" || !r.StartDate().Equal(march11) || !r.EndDate().Equal(march13) || r.Price() != 200 {
+		t.Errorf(
+			"expected room 102 from %s to %s for $200, got room %s from %s to %s for $%d",
+			march11, march13, r.RoomID(), r.StartDate(), r.EndDate(), r.Price(),
+		)
+	}
+
+	if len(r.changes) != 1 {
+		t.Fatalf("expected BookingModified to be recorded, got %d events", len(r.changes))
+	}
+	modified := r.changes[0].(*events.BookingModified)
+	if modified.OldRoomId != "101" || modified.OldPrice != 500 || modified.PriceDelta != -300 {
+		t.Errorf("expected old room 101 for $500 and price delta -300, got %v", modified)
+	}
+
+	if err := r.Modify("modification-2", "102", march13, march13, &events.PriceBreakdown{}); errors.Cause(err) != ErrInvalidBookingDates {
+		t.Errorf("expected ErrInvalidBookingDates, got %v", err)
+	}
+	if err := r.Modify("modification-2", "102", march11, march15, &events.PriceBreakdown{Total: -1}); err == nil {
+		t.Error("expected error for negative price")
+	}
+	if len(r.changes) != 1 {
+		t.Errorf("failed modification should not record events, got %d events", len(r.changes))
+	}
+}
+
+func TestReservation_Modify_checkedIn(t *testing.T) {
+	march10 := time.Date(2027, 3, 10, 0, 0, 0, 0, time.UTC)
+	march15 := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)
+	march17 := time.Date(2027, 3, 17, 0, 0, 0, 0, time.UTC)
+
+	r, err := NewReservation("1", "101", "John", march10, march15, &events.PriceBreakdown{Total: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CheckIn(march10.Add(14 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Modify("modification-1", "101", march10, march17, &events.PriceBreakdown{Total: 700}); errors.Cause(err) != ErrAlreadyCheckedIn {
+		t.Errorf("expected ErrAlreadyCheckedIn, got %v", err)
+	}
+}
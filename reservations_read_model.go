@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"log"
+	"main.go/events"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// reservationsProjection is the name under which ReservationsReadModel is saved in ProjectionStore.
+const reservationsProjection = "reservations"
+
+// ReservationView is a reservation as it is presented by the query API.
+type ReservationView struct {
+	ID           string            `json:"id"`
+	RoomID       string            `json:"room_id"`
+	GuestName    string            `json:"guest_name"`
+	StartDate    time.Time         `json:"start_date"`
+	EndDate      time.Time         `json:"end_date"`
+	Price        int64             `json:"price"`
+	Status       ReservationStatus `json:"status"`
+	CheckedInAt  *time.Time        `json:"checked_in_at,omitempty"`
+	CheckedOutAt *time.Time        `json:"checked_out_at,omitempty"`
+	RefundAmount int64             `json:"refund_amount,omitempty"`
+	Credit       int64             `json:"credit,omitempty"`
+}
+
+// ReservationsReadModel is a read model with all reservations, used by the query API.
+//
+// Every reservation is saved in ProjectionStore as a separate item, only the reservation changed by the event is saved.
+type ReservationsReadModel struct {
+	reservations map[string]ReservationView
+	store        ProjectionStore
+	lock         sync.RWMutex
+}
+
+func NewReservationsReadModel(ctx context.Context, store ProjectionStore) (*ReservationsReadModel, error) {
+	reservations := map[string]ReservationView{}
+	if err := store.LoadItems(ctx, reservationsProjection, &reservations); err != nil {
+		return nil, err
+	}
+
+	return &ReservationsReadModel{reservations: reservations, store: store}, nil
+}
+
+// EventHandlers returns handlers of all events which are changing reservations.
+func (r *ReservationsReadModel) EventHandlers() []cqrs.EventHandler {
+	return []cqrs.EventHandler{
+		r.eventHandler("ReservationsReadModel", func() interface{} { return &events.RoomBooked{} }),
+		r.eventHandler("ReservationsReadModelOnBookingModified", func() interface{} { return &events.BookingModified{} }),
+		r.eventHandler("ReservationsReadModelOnGuestCheckedIn", func() interface{} { return &events.GuestCheckedIn{} }),
+		r.eventHandler("ReservationsReadModelOnGuestCheckedOut", func() interface{} { return &events.GuestCheckedOut{} }),
+		r.eventHandler("ReservationsReadModelOnBookingCancelled", func() interface{} { return &events.BookingCancelled{} }),
+		r.eventHandler("ReservationsReadModelOnCreditApplied", func() interface{} { return &events.CreditApplied{} }),
+	}
+}
+
+func (r *ReservationsReadModel) eventHandler(name string, newEvent func() interface{}) cqrs.EventHandler {
+	return eventHandler{
+		name:     name,
+		newEvent: newEvent,
+		handle: func(ctx context.Context, e interface{}) error {
+			return r.handle(ctx, e.(proto.Message))
+		},
+	}
+}
+
+func (r *ReservationsReadModel) handle(ctx context.Context, event proto.Message) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	reservationID, err := r.apply(event)
+	if err != nil || reservationID == "" {
+		return err
+	}
+
+	if err := r.store.SaveItem(ctx, reservationsProjection, reservationID, r.reservations[reservationID]); err != nil {
+		// event will be redelivered, so the reservation in memory must go back to what was saved
+		r.reload(ctx, reservationID)
+		return err
+	}
+
+	return nil
+}
+
+// apply changes the reservation according to the event and returns its id.
+// Empty id is returned when nothing changed.
+func (r *ReservationsReadModel) apply(event proto.Message) (string, error) {
+	switch e := event.(type) {
+	case *events.RoomBooked:
+		// redelivered RoomBooked must not overwrite later changes
+		if _, ok := r.reservations[e.ReservationId]; ok {
+			return "", nil
+		}
+
+		r.reservations[e.ReservationId] = ReservationView{
+			ID:        e.ReservationId,
+			RoomID:    e.RoomId,
+			GuestName: e.GuestName,
+			StartDate: e.StartDate.AsTime(),
+			EndDate:   e.EndDate.AsTime(),
+			Price:     e.Price,
+			Status:    ReservationBooked,
+		}
+		return e.ReservationId, nil
+	case *events.BookingModified:
+		return r.update(e.ReservationId, func(reservation *ReservationView) {
+			reservation.RoomID = e.RoomId
+			reservation.StartDate = e.StartDate.AsTime()
+			reservation.EndDate = e.EndDate.AsTime()
+			reservation.Price = e.Price
+		})
+	case *events.GuestCheckedIn:
+		return r.update(e.ReservationId, func(reservation *ReservationView) {
+			checkedInAt := e.CheckedInAt.AsTime()
+
+			reservation.Status = ReservationCheckedIn
+			reservation.CheckedInAt = &checkedInAt
+		})
+	case *events.GuestCheckedOut:
+		return r.update(e.ReservationId, func(reservation *ReservationView) {
+			checkedOutAt := e.CheckedOutAt.AsTime()
+
+			reservation.Status = ReservationCheckedOut
+			reservation.CheckedOutAt = &checkedOutAt
+		})
+	case *events.BookingCancelled:
+		return r.update(e.ReservationId, func(reservation *ReservationView) {
+			reservation.Status = ReservationCancelled
+			reservation.RefundAmount = e.RefundAmount
+		})
+	case *events.CreditApplied:
+		return r.update(e.ReservationId, func(reservation *ReservationView) {
+			reservation.Credit += e.Amount
+		})
+	default:
+		return "", nil
+	}
+}
+
+func (r *ReservationsReadModel) update(reservationID string, update func(reservation *ReservationView)) (string, error) {
+	reservation, ok := r.reservations[reservationID]
+	if !ok {
+		// RoomBooked was not handled yet (events of different handlers are not ordered),
+		// the event is redelivered until it is
+		return "", errors.Errorf("reservation %s not found in read model", reservationID)
+	}
+
+	update(&reservation)
+	r.reservations[reservationID] = reservation
+
+	return reservationID, nil
+}
+
+// reload sets the reservation back to its saved state.
+func (r *ReservationsReadModel) reload(ctx context.Context, reservationID string) {
+	reservations := map[string]ReservationView{}
+	if err := r.store.LoadItems(ctx, reservationsProjection, &reservations); err != nil {
+		log.Printf("Cannot reload reservation %s of read model: %s", reservationID, err)
+		return
+	}
+
+	if reservation, ok := reservations[reservationID]; ok {
+		r.reservations[reservationID] = reservation
+	} else {
+		delete(r.reservations, reservationID)
+	}
+}
+
+// Reservation returns the reservation by id, false is returned when it doesn't exist.
+func (r *ReservationsReadModel) Reservation(reservationID string) (ReservationView, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	reservation, ok := r.reservations[reservationID]
+	return reservation, ok
+}
+
+// Reservations returns all reservations sorted by start date.
+func (r *ReservationsReadModel) Reservations() []ReservationView {
+	return r.filter(func(ReservationView) bool { return true })
+}
+
+// RoomBookings returns reservations of the room sorted by start date.
+func (r *ReservationsReadModel) RoomBookings(roomID string) []ReservationView {
+	return r.filter(func(reservation ReservationView) bool {
+		return reservation.RoomID == roomID
+	})
+}
+
+func (r *ReservationsReadModel) filter(include func(ReservationView) bool) []ReservationView {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	reservations := []ReservationView{}
+	for _, reservation := range r.reservations {
+		if include(reservation) {
+			reservations = append(reservations, reservation)
+		}
+	}
+
+	sort.Slice(reservations, func(i, j int) bool {
+		if reservations[i].StartDate.Equal(reservations[j].StartDate) {
+			return reservations[i].ID < reservations[j].ID
+		}
+		return reservations[i].StartDate.Before(reservations[j].StartDate)
+	})
+
+	return reservations
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"main.go/events"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrScheduledCommandNotFound   = errors.New("scheduled command not found")
+	ErrScheduledCommandNotPending = errors.New("scheduled command was already sent or cancelled")
+	ErrUnknownCommand             = errors.New("unknown command")
+)
+
+// schedulableCommands are commands of the public API, which can be scheduled.
+// Commands sent only by the service itself (like ApplyCredit of BookingProcess) can't be scheduled.
+var schedulableCommands = []proto.Message{
+	&events.BookRoom{},
+	&events.CancelBooking{},
+	&events.ModifyBooking{},
+	&events.CheckIn{},
+	&events.CheckOut{},
+	&events.OrderBeer{},
+	&events.RestockBeer{},
+}
+
+type ScheduledCommandStatus string
+
+const (
+	ScheduledCommandPending   ScheduledCommandStatus = "scheduled"
+	ScheduledCommandSent      ScheduledCommandStatus = "sent"
+	ScheduledCommandCancelled ScheduledCommandStatus = "cancelled"
+)
+
+// ScheduledCommand is a command, which is sent by CommandScheduler at DeliverAt.
+type ScheduledCommand struct {
+	// ID is also UUID of the sent command
+	ID        string
+	Name      string
+	Command   proto.Message
+	DeliverAt time.Time
+	Status    ScheduledCommandStatus
+	CreatedAt time.Time
+	SentAt    *time.Time
+
+	correlationID string
+}
+
+// CommandScheduler sends commands with cqrs.CommandBus at the given time, for example to cancel unpaid booking later.
+//
+// Scheduled commands are stored in SQLite, so they are sent also when the service was restarted in the meantime
+// (commands which became due while the service was stopped are sent right after start).
+// The command is sent with its id as UUID and marked as sent in one transaction, so when marking fails,
+// the command is sent again and skipped by its handler (see IdempotencyMiddleware).
+type CommandScheduler struct {
+	db        *sql.DB
+	marshaler cqrs.CommandEventMarshaler
+}
+
+func NewCommandScheduler(db *sql.DB, marshaler cqrs.CommandEventMarshaler) (*CommandScheduler, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS scheduled_commands (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			payload BLOB NOT NULL,
+			correlation_id TEXT NOT NULL,
+			deliver_at TIMESTAMP NOT NULL,
+			status TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			sent_at TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS scheduled_commands_due ON scheduled_commands (status, deliver_at)`,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create scheduled_commands table")
+	}
+
+	return &CommandScheduler{db: db, marshaler: marshaler}, nil
+}
+
+// NewCommand returns empty command of the type with the name given by the marshaler (like "events.OrderBeer")
+// or the name of its struct ("OrderBeer"). ErrUnknownCommand is returned when such command can't be scheduled
+// (see schedulableCommands).
+func (s *CommandScheduler) NewCommand(name string) (proto.Message, error) {
+	for _, command := range schedulableCommands {
+		if s.marshaler.Name(command) == name || cqrs.StructName(command) == name {
+			return command.ProtoReflect().New().Interface(), nil
+		}
+	}
+
+	return nil, errors.Wrapf(ErrUnknownCommand, "command %s", name)
+}
+
+// Schedule stores the command to be sent at deliverAt and returns its id.
+// Command scheduled to the past is sent as soon as possible.
+// Correlation id of ctx is passed to the command, when it's sent.
+func (s *CommandScheduler) Schedule(ctx context.Context, cmd proto.Message, deliverAt time.Time) (string, error) {
+	name := s.marshaler.Name(cmd)
+	if _, err := s.NewCommand(name); err != nil {
+		return "", err
+	}
+
+	payload, err := proto.Marshal(cmd)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot marshal command %s", name)
+	}
+
+	id := watermill.NewUUID()
+	correlationID, _ := CorrelationID(ctx)
+
+	err = runInTx(ctx, s.db, func(ctx context.Context) error {
+		tx, _ := txFromContext(ctx)
+
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO scheduled_commands (id, name, payload, correlation_id, deliver_at, status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			id, name, payload, correlationID, deliverAt.UTC(), ScheduledCommandPending, time.Now().UTC(),
+		)
+		return errors.Wrapf(err, "cannot schedule command %s", name)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Cancel cancels the command, which was not sent yet.
+func (s *CommandScheduler) Cancel(ctx context.Context, id string) error {
+	return runInTx(ctx, s.db, func(ctx context.Context) error {
+		tx, _ := txFromContext(ctx)
+
+		var status ScheduledCommandStatus
+		err := tx.QueryRowContext(ctx, `SELECT status FROM scheduled_commands WHERE id = ?`, id).Scan(&status)
+		if err == sql.ErrNoRows {
+			return errors.Wrapf(ErrScheduledCommandNotFound, "scheduled command %s", id)
+		} else if err != nil {
+			return errors.Wrapf(err, "cannot load scheduled command %s", id)
+		}
+		if status != ScheduledCommandPending {
+			return errors.Wrapf(ErrScheduledCommandNotPending, "scheduled command %s is %s", id, status)
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE scheduled_commands SET status = ? WHERE id = ?`, ScheduledCommandCancelled, id)
+		return errors.Wrapf(err, "cannot cancel scheduled command %s", id)
+	})
+}
+
+// List returns scheduled commands with the status (all of them when status is empty), the earliest first.
+func (s *CommandScheduler) List(ctx context.Context, status ScheduledCommandStatus) ([]ScheduledCommand, error) {
+	if status == "" {
+		return s.query(ctx, `SELECT `+scheduledCommandColumns+` FROM scheduled_commands ORDER BY deliver_at, created_at`)
+	}
+
+	return s.query(
+		ctx,
+		`SELECT `+scheduledCommandColumns+` FROM scheduled_commands WHERE status = ? ORDER BY deliver_at, created_at`,
+		status,
+	)
+}
+
+// Run sends due commands with the given interval until ctx is done.
+func (s *CommandScheduler) Run(ctx context.Context, commandBus *cqrs.CommandBus, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.sendDue(ctx, commandBus); err != nil && ctx.Err() == nil {
+			log.Printf("Cannot send scheduled commands: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *CommandScheduler) sendDue(ctx context.Context, commandBus *cqrs.CommandBus) error {
+	due, err := s.query(
+		ctx,
+		`SELECT `+scheduledCommandColumns+` FROM scheduled_commands WHERE status = ? AND deliver_at <= ? ORDER BY deliver_at, created_at`,
+		ScheduledCommandPending, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, cmd := range due {
+		if err := s.send(ctx, commandBus, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// send sends the command and marks it as sent, unless it was cancelled in the meantime.
+func (s *CommandScheduler) send(ctx context.Context, commandBus *cqrs.CommandBus, cmd ScheduledCommand) error {
+	return runInTx(ctx, s.db, func(ctx context.Context) error {
+		tx, _ := txFromContext(ctx)
+
+		result, err := tx.ExecContext(
+			ctx,
+			`UPDATE scheduled_commands SET status = ?, sent_at = ? WHERE id = ? AND status = ?`,
+			ScheduledCommandSent, time.Now().UTC(), cmd.ID, ScheduledCommandPending,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "cannot mark scheduled command %s as sent", cmd.ID)
+		}
+		if updated, err := result.RowsAffected(); err != nil {
+			return errors.Wrapf(err, "cannot mark scheduled command %s as sent", cmd.ID)
+		} else if updated == 0 {
+			return nil
+		}
+
+		sendCtx := WithMessageUUID(ctx, cmd.ID)
+		if cmd.correlationID != "" {
+			sendCtx = WithCorrelationID(sendCtx, cmd.correlationID)
+		}
+		if err := commandBus.Send(sendCtx, cmd.Command); err != nil {
+			return errors.Wrapf(err, "cannot send scheduled command %s", cmd.ID)
+		}
+
+		log.Printf("Sent scheduled command %s %s (scheduled to %s)", cmd.Name, cmd.ID, cmd.DeliverAt.Format(time.RFC3339))
+		return nil
+	})
+}
+
+const scheduledCommandColumns = `id, name, payload, correlation_id, deliver_at, status, created_at, sent_at`
+
+func (s *CommandScheduler) query(ctx context.Context, query string, args ...interface{}) ([]ScheduledCommand, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot query scheduled commands")
+	}
+	defer rows.Close()
+
+	var commands []ScheduledCommand
+	for rows.Next() {
+		var cmd ScheduledCommand
+		var payload []byte
+		var sentAt sql.NullTime
+
+		if err := rows.Scan(
+			&cmd.ID,
+			&cmd.Name,
+			&payload,
+			&cmd.correlationID,
+			&cmd.DeliverAt,
+			&cmd.Status,
+			&cmd.CreatedAt,
+			&sentAt,
+		); err != nil {
+			return nil, errors.Wrap(err, "cannot scan scheduled command")
+		}
+
+		command, ok, err := decodeStoredEvent(s.marshaler, StoredEvent{UUID: cmd.ID, Name: cmd.Name, Payload: payload}, allCommands)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.Wrapf(ErrUnknownCommand, "scheduled command %s is %s", cmd.ID, cmd.Name)
+		}
+		cmd.Command = command
+
+		if sentAt.Valid {
+			cmd.SentAt = &sentAt.Time
+		}
+
+		commands = append(commands, cmd)
+	}
+
+	return commands, errors.Wrap(rows.Err(), "cannot iterate scheduled commands")
+}
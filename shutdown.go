@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// HandlerDrainer is a router middleware, which allows handlers in progress to finish before the router is closed.
+//
+// message.Router waits only for the subscribers to stop, so a message which is being handled while closing
+// the router is not acked and it's handled again after restart.
+type HandlerDrainer struct {
+	running  sync.WaitGroup
+	draining bool
+	lock     sync.RWMutex
+}
+
+func NewHandlerDrainer() *HandlerDrainer {
+	return &HandlerDrainer{}
+}
+
+func (d *HandlerDrainer) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		d.lock.RLock()
+		if d.draining {
+			d.lock.RUnlock()
+
+			// message context is cancelled when the router closes subscribers,
+			// the message is nacked after that, so it's not redelivered to this instance again
+			// (it's not returned as an error, because it's not a failure of the handler)
+			<-msg.Context().Done()
+			msg.Nack()
+			return nil, nil
+		}
+		d.running.Add(1)
+		d.lock.RUnlock()
+
+		defer d.running.Done()
+		return h(msg)
+	}
+}
+
+// Drain stops handling of new messages and waits until handlers in progress are finished.
+// It returns false when handlers didn't finish before ctx is done.
+func (d *HandlerDrainer) Drain(ctx context.Context) bool {
+	d.lock.Lock()
+	d.draining = true
+	d.lock.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		d.running.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
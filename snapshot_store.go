@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// SnapshotStore keeps the latest snapshot of aggregate's state per event store stream,
+// so the aggregate doesn't need to replay all its events when it's loaded.
+type SnapshotStore interface {
+	// Save stores the snapshot of the state at the given stream version, replacing the previous one.
+	Save(ctx context.Context, streamID string, version int64, state interface{}) error
+
+	// Load unmarshals the latest snapshot into state and returns its version.
+	// When there is no snapshot, 0 is returned.
+	Load(ctx context.Context, streamID string, state interface{}) (int64, error)
+}
+
+// SQLiteSnapshotStore is SnapshotStore keeping state marshaled to JSON.
+type SQLiteSnapshotStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteSnapshotStore(db *sql.DB) (*SQLiteSnapshotStore, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS snapshots (
+			stream_id TEXT PRIMARY KEY,
+			version INTEGER NOT NULL,
+			state TEXT NOT NULL
+		)`,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create snapshots table")
+	}
+
+	return &SQLiteSnapshotStore{db}, nil
+}
+
+func (s *SQLiteSnapshotStore) Save(ctx context.Context, streamID string, version int64, state interface{}) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal snapshot")
+	}
+
+	// older snapshot must not replace the newer one
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO snapshots (stream_id, version, state) VALUES (?, ?, ?)
+		ON CONFLICT (stream_id) DO UPDATE SET version = excluded.version, state = excluded.state
+		WHERE excluded.version > snapshots.version`,
+		streamID, version, string(b),
+	)
+	return errors.Wrapf(err, "cannot save snapshot of %s", streamID)
+}
+
+func (s *SQLiteSnapshotStore) Load(ctx context.Context, streamID string, state interface{}) (int64, error) {
+	var version int64
+	var b string
+
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT version, state FROM snapshots WHERE stream_id = ?`,
+		streamID,
+	).Scan(&version, &b)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Wrapf(err, "cannot load snapshot of %s", streamID)
+	}
+
+	if err := json.Unmarshal([]byte(b), state); err != nil {
+		return 0, errors.Wrapf(err, "cannot unmarshal snapshot of %s", streamID)
+	}
+
+	return version, nil
+}
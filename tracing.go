@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "hotel"
+
+// NewTracerProvider creates provider of tracers exporting spans with the configured exporter: "none", "stdout" or "otlp".
+// Returned function flushes spans which were not exported yet and stops the exporter.
+func NewTracerProvider(config TracingConfig) (trace.TracerProvider, func(ctx context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch config.Exporter {
+	case "none":
+		return trace.NewNoopTracerProvider(), func(ctx context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		exporter, err = otlptracegrpc.New(
+			context.Background(),
+			otlptracegrpc.WithEndpoint(config.OTLPEndpoint),
+			otlptracegrpc.WithInsecure(),
+		)
+	default:
+		return nil, nil, errors.Errorf("unknown tracing exporter %q", config.Exporter)
+	}
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "cannot create %s exporter", config.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(config.ServiceName))),
+	)
+
+	return provider, provider.Shutdown, nil
+}
+
+// traceContextPropagator passes trace context between services in W3C Trace Context format.
+var traceContextPropagator = propagation.TraceContext{}
+
+// metadataCarrier is propagation.TextMapCarrier storing trace context in message metadata.
+type metadataCarrier message.Metadata
+
+func (c metadataCarrier) Get(key string) string {
+	return message.Metadata(c).Get(key)
+}
+
+func (c metadataCarrier) Set(key string, value string) {
+	message.Metadata(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// TracingPublisher is message.Publisher decorator, which starts a span for every published message
+// and passes its trace context in the message metadata, so the handler of the message continues the same trace.
+//
+// Trace is taken from the message context, which is the context passed to cqrs.CommandBus.Send or cqrs.EventBus.Publish.
+type TracingPublisher struct {
+	publisher message.Publisher
+	tracer    trace.Tracer
+}
+
+func NewTracingPublisher(publisher message.Publisher, tracerProvider trace.TracerProvider) TracingPublisher {
+	return TracingPublisher{publisher, tracerProvider.Tracer(tracerName)}
+}
+
+func (p TracingPublisher) Publish(topic string, messages ...*message.Message) error {
+	spans := make([]trace.Span, 0, len(messages))
+	for _, msg := range messages {
+		ctx, span := p.tracer.Start(
+			msg.Context(),
+			"publish "+msg.Metadata.Get("name"),
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				semconv.MessagingSystemKey.String("watermill"),
+				semconv.MessagingDestinationKey.String(topic),
+				semconv.MessagingMessageIDKey.String(msg.UUID),
+			),
+		)
+		traceContextPropagator.Inject(ctx, metadataCarrier(msg.Metadata))
+		msg.SetContext(ctx)
+
+		spans = append(spans, span)
+	}
+
+	err := p.publisher.Publish(topic, messages...)
+	for _, span := range spans {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+
+	return err
+}
+
+func (p TracingPublisher) Close() error {
+	return p.publisher.Close()
+}
+
+// TracingMiddleware is router middleware, which starts a span for every handled message.
+// The span continues the trace from the message metadata (see TracingPublisher) and it's set in the message context,
+// so commands and events sent by the handler are in the same trace.
+type TracingMiddleware struct {
+	tracer trace.Tracer
+
+	// handledMessages are names of messages handled by each handler,
+	// event handlers are receiving all events from the topic, but ignored events are not traced
+	handledMessages map[string]string
+}
+
+func NewTracingMiddleware(tracerProvider trace.TracerProvider, handledMessages map[string]string) TracingMiddleware {
+	return TracingMiddleware{tracerProvider.Tracer(tracerName), handledMessages}
+}
+
+func (m TracingMiddleware) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		handlerName := message.HandlerNameFromCtx(msg.Context())
+
+		if name, ok := m.handledMessages[handlerName]; ok && name != msg.Metadata.Get("name") {
+			return h(msg)
+		}
+
+		ctx := traceContextPropagator.Extract(msg.Context(), metadataCarrier(msg.Metadata))
+		ctx, span := m.tracer.Start(
+			ctx,
+			handlerName,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				semconv.MessagingSystemKey.String("watermill"),
+				semconv.MessagingDestinationKey.String(message.SubscribeTopicFromCtx(msg.Context())),
+				semconv.MessagingOperationProcess,
+				semconv.MessagingMessageIDKey.String(msg.UUID),
+			),
+		)
+		defer span.End()
+		msg.SetContext(ctx)
+
+		produced, err := h(msg)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		return produced, err
+	}
+}
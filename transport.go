@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-amqp/v2/pkg/amqp"
+	watermillSQL "github.com/ThreeDotsLabs/watermill-sql/pkg/sql"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/pkg/errors"
+
+	// drivers of databases supported by SQL transport
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+)
+
+// Transport builds publishers and subscribers of commands and events used by cqrs.Facade.
+//
+// It allows to run the same handlers with RabbitMQ, in a single process without any broker (GoChannel)
+// or with SQL database as a message broker.
+type Transport interface {
+	CommandsPublisher() message.Publisher
+	// CommandsSubscriber is shared by all command handlers, because every command has its own topic.
+	CommandsSubscriber() message.Subscriber
+
+	EventsPublisher() message.Publisher
+	// EventsSubscriber returns subscriber of the event handler, every event handler must receive all events.
+	EventsSubscriber(handlerName string) (message.Subscriber, error)
+
+	// Check returns status of the connections to the broker, error means that messages can't be sent or received.
+	Check(ctx context.Context) (TransportStatus, error)
+
+	// Close closes all publishers and subscribers created by the transport.
+	Close() error
+}
+
+// TransportStatus is the state of the transport reported by the readiness check.
+type TransportStatus struct {
+	// Connected are states of the connections of publishers and subscribers.
+	Connected map[string]bool `json:"connected,omitempty"`
+	// Lag is the number of messages waiting in the queue of each subscriber, it's known only for RabbitMQ.
+	Lag map[string]int `json:"lag,omitempty"`
+}
+
+// NewTransport creates transport by its kind: "amqp", "gochannel" or "sql".
+func NewTransport(config TransportConfig, logger watermill.LoggerAdapter) (Transport, error) {
+	switch config.Kind {
+	case "amqp":
+		return NewAMQPTransport(config.AMQP, logger)
+	case "gochannel":
+		return NewGoChannelTransport(logger), nil
+	case "sql":
+		return NewSQLTransport(config.SQL.Dialect, config.SQL.DSN, logger)
+	default:
+		return nil, errors.Errorf("unknown transport %q", config.Kind)
+	}
+}
+
+// AMQPTransport sends messages via RabbitMQ.
+// Detailed RabbitMQ implementation: https://watermill.io/docs/pub-sub-implementations/#rabbitmq-amqp
+type AMQPTransport struct {
+	config AMQPConfig
+	logger watermill.LoggerAdapter
+
+	commandsPublisher  *amqp.Publisher
+	commandsSubscriber amqpSubscriber
+	eventsPublisher    *amqp.Publisher
+
+	// eventsSubscribers are subscribers of the event handlers by their names
+	eventsSubscribers map[string]amqpSubscriber
+	// queues are names of queues consumed by the subscribers, their length is reported by Check
+	queues map[string]bool
+	lock   sync.Mutex
+
+	// closers are all created publishers and subscribers
+	closers []io.Closer
+}
+
+func NewAMQPTransport(config AMQPConfig, logger watermill.LoggerAdapter) (*AMQPTransport, error) {
+	t := &AMQPTransport{
+		config:            config,
+		logger:            logger,
+		eventsSubscribers: map[string]amqpSubscriber{},
+		queues:            map[string]bool{},
+	}
+	address := config.Address
+
+	// Commands will be send to queue, because they need to be consumed once.
+	commandsConfig := amqp.NewDurableQueueConfig(address)
+
+	var err error
+	t.commandsPublisher, err = amqp.NewPublisher(commandsConfig, logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create commands publisher")
+	}
+	t.commandsSubscriber, err = t.newSubscriber(commandsConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create commands subscriber")
+	}
+
+	// Events will be published to PubSub configured Rabbit, because they may be consumed by multiple consumers.
+	// (in that case BookingsFinancialReport and BookingProcess).
+	t.eventsPublisher, err = amqp.NewPublisher(amqp.NewDurablePubSubConfig(address, nil), logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create events publisher")
+	}
+
+	t.closers = []io.Closer{t.commandsPublisher, t.commandsSubscriber, t.eventsPublisher}
+
+	return t, nil
+}
+
+func (t *AMQPTransport) newSubscriber(config amqp.Config) (amqpSubscriber, error) {
+	subscriber, err := amqp.NewSubscriber(config, t.logger)
+	if err != nil {
+		return amqpSubscriber{}, err
+	}
+
+	return amqpSubscriber{subscriber, config, t}, nil
+}
+
+func (t *AMQPTransport) CommandsPublisher() message.Publisher {
+	return t.commandsPublisher
+}
+
+func (t *AMQPTransport) CommandsSubscriber() message.Subscriber {
+	return t.commandsSubscriber
+}
+
+func (t *AMQPTransport) EventsPublisher() message.Publisher {
+	return t.eventsPublisher
+}
+
+func (t *AMQPTransport) EventsSubscriber(handlerName string) (message.Subscriber, error) {
+	// every event handler has its own queue, so each of them receives all events
+	config := amqp.NewDurablePubSubConfig(
+		t.config.Address,
+		amqp.GenerateQueueNameTopicNameWithSuffix(handlerName+t.config.QueueSuffix),
+	)
+
+	subscriber, err := t.newSubscriber(config)
+	if err != nil {
+		return nil, err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.eventsSubscribers[handlerName] = subscriber
+	t.closers = append(t.closers, subscriber)
+
+	return subscriber, nil
+}
+
+// Check reports connections of all publishers and subscribers, and the number of messages ready in their queues.
+func (t *AMQPTransport) Check(ctx context.Context) (TransportStatus, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	status := TransportStatus{
+		Connected: map[string]bool{
+			"commands_publisher":  t.commandsPublisher.IsConnected(),
+			"commands_subscriber": t.commandsSubscriber.IsConnected(),
+			"events_publisher":    t.eventsPublisher.IsConnected(),
+		},
+		Lag: map[string]int{},
+	}
+	for handlerName, subscriber := range t.eventsSubscribers {
+		status.Connected[handlerName] = subscriber.IsConnected()
+	}
+
+	var disconnected []string
+	for name, connected := range status.Connected {
+		if !connected {
+			disconnected = append(disconnected, name)
+		}
+	}
+	if len(disconnected) > 0 {
+		sort.Strings(disconnected)
+		return status, errors.Errorf("not connected to RabbitMQ: %s", strings.Join(disconnected, ", "))
+	}
+
+	channel, err := t.commandsPublisher.Connection().Channel()
+	if err != nil {
+		return status, errors.Wrap(err, "cannot open channel")
+	}
+	defer channel.Close()
+
+	for queue := range t.queues {
+		// passive declare, it fails when the queue doesn't exist
+		q, err := channel.QueueInspect(queue)
+		if err != nil {
+			return status, errors.Wrapf(err, "cannot inspect queue %s", queue)
+		}
+		status.Lag[queue] = q.Messages
+	}
+
+	return status, nil
+}
+
+func (t *AMQPTransport) Close() error {
+	return closeAll(t.closers)
+}
+
+// amqpSubscriber remembers queues of the subscribed topics, so AMQPTransport can check their length.
+type amqpSubscriber struct {
+	*amqp.Subscriber
+	config    amqp.Config
+	transport *AMQPTransport
+}
+
+func (s amqpSubscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	messages, err := s.Subscriber.Subscribe(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	s.transport.lock.Lock()
+	defer s.transport.lock.Unlock()
+	s.transport.queues[s.config.Queue.GenerateName(topic)] = true
+
+	return messages, nil
+}
+
+// GoChannelTransport sends messages in memory, it doesn't need any broker, so it's useful for development and tests.
+// Messages are lost when the service is stopped.
+type GoChannelTransport struct {
+	pubSub *gochannel.GoChannel
+}
+
+func NewGoChannelTransport(logger watermill.LoggerAdapter) *GoChannelTransport {
+	return &GoChannelTransport{
+		pubSub: gochannel.NewGoChannel(gochannel.Config{}, logger),
+	}
+}
+
+func (t *GoChannelTransport) CommandsPublisher() message.Publisher {
+	return t.pubSub
+}
+
+func (t *GoChannelTransport) CommandsSubscriber() message.Subscriber {
+	return t.pubSub
+}
+
+func (t *GoChannelTransport) EventsPublisher() message.Publisher {
+	return t.pubSub
+}
+
+func (t *GoChannelTransport) EventsSubscriber(handlerName string) (message.Subscriber, error) {
+	// GoChannel delivers every message to all subscribers of the topic, so one instance is enough
+	return t.pubSub, nil
+}
+
+// Check always succeeds, messages are sent in memory.
+func (t *GoChannelTransport) Check(ctx context.Context) (TransportStatus, error) {
+	return TransportStatus{}, nil
+}
+
+func (t *GoChannelTransport) Close() error {
+	return t.pubSub.Close()
+}
+
+// SQLTransport uses MySQL or PostgreSQL database as a message broker, every topic is stored in its own table.
+// More about SQL Pub/Sub: https://watermill.io/docs/pub-sub-implementations/#sql
+type SQLTransport struct {
+	db     *sql.DB
+	logger watermill.LoggerAdapter
+
+	schemaAdapter  watermillSQL.SchemaAdapter
+	offsetsAdapter watermillSQL.OffsetsAdapter
+
+	publisher          *watermillSQL.Publisher
+	commandsSubscriber *watermillSQL.Subscriber
+
+	// closers are all created publishers and subscribers
+	closers []io.Closer
+}
+
+// NewSQLTransport creates SQL transport, dialect is "mysql" or "postgres".
+func NewSQLTransport(dialect string, dsn string, logger watermill.LoggerAdapter) (*SQLTransport, error) {
+	t := &SQLTransport{logger: logger}
+
+	switch dialect {
+	case "mysql":
+		t.schemaAdapter = mySQLSchema{}
+		t.offsetsAdapter = watermillSQL.DefaultMySQLOffsetsAdapter{}
+	case "postgres":
+		t.schemaAdapter = postgreSQLSchema{}
+		t.offsetsAdapter = watermillSQL.DefaultPostgreSQLOffsetsAdapter{}
+	default:
+		return nil, errors.Errorf("unknown SQL dialect %q", dialect)
+	}
+
+	db, err := sql.Open(dialect, dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open SQL transport database")
+	}
+	if err := db.Ping(); err != nil {
+		return nil, errors.Wrap(err, "cannot connect to SQL transport database")
+	}
+	t.db = db
+
+	// the same publisher can be used for commands and events, because both are just rows in the topic table
+	t.publisher, err = watermillSQL.NewPublisher(db, watermillSQL.PublisherConfig{
+		SchemaAdapter:        t.schemaAdapter,
+		AutoInitializeSchema: true,
+	}, logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create SQL publisher")
+	}
+
+	// all instances of the service are in the same consumer group, so every command is handled once
+	t.commandsSubscriber, err = t.newSubscriber("commands")
+	if err != nil {
+		return nil, err
+	}
+
+	t.closers = []io.Closer{t.publisher, t.commandsSubscriber}
+
+	return t, nil
+}
+
+func (t *SQLTransport) newSubscriber(consumerGroup string) (*watermillSQL.Subscriber, error) {
+	subscriber, err := watermillSQL.NewSubscriber(t.db, watermillSQL.SubscriberConfig{
+		ConsumerGroup:    consumerGroup,
+		SchemaAdapter:    t.schemaAdapter,
+		OffsetsAdapter:   t.offsetsAdapter,
+		InitializeSchema: true,
+	}, t.logger)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create SQL subscriber for %s", consumerGroup)
+	}
+
+	return subscriber, nil
+}
+
+func (t *SQLTransport) CommandsPublisher() message.Publisher {
+	return t.publisher
+}
+
+func (t *SQLTransport) CommandsSubscriber() message.Subscriber {
+	return t.commandsSubscriber
+}
+
+func (t *SQLTransport) EventsPublisher() message.Publisher {
+	return t.publisher
+}
+
+func (t *SQLTransport) EventsSubscriber(handlerName string) (message.Subscriber, error) {
+	// every event handler has its own consumer group (and offset), so each of them receives all events
+	subscriber, err := t.newSubscriber(handlerName)
+	if err != nil {
+		return nil, err
+	}
+	t.closers = append(t.closers, subscriber)
+
+	return subscriber, nil
+}
+
+// Check checks connection to the database, consumer lag is not reported.
+func (t *SQLTransport) Check(ctx context.Context) (TransportStatus, error) {
+	err := t.db.PingContext(ctx)
+
+	return TransportStatus{Connected: map[string]bool{"database": err == nil}}, errors.Wrap(err, "cannot connect to SQL transport database")
+}
+
+func (t *SQLTransport) Close() error {
+	// database is closed after all subscribers stopped using it
+	return closeAll(append(t.closers, t.db))
+}
+
+// mySQLSchema stores payload as a binary, because default schema expects JSON and our messages are protobuf.
+type mySQLSchema struct {
+	watermillSQL.DefaultMySQLSchema
+}
+
+func (s mySQLSchema) SchemaInitializingQueries(topic string) []string {
+	return []string{strings.Join([]string{
+		"CREATE TABLE IF NOT EXISTS " + s.MessagesTable(topic) + " (",
+		"`offset` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,",
+		"`uuid` VARCHAR(36) NOT NULL,",
+		"`created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,",
+		"`payload` BLOB DEFAULT NULL,",
+		"`metadata` JSON DEFAULT NULL",
+		");",
+	}, "\n")}
+}
+
+// postgreSQLSchema stores payload as a binary, because default schema expects JSON and our messages are protobuf.
+type postgreSQLSchema struct {
+	watermillSQL.DefaultPostgreSQLSchema
+}
+
+func (s postgreSQLSchema) SchemaInitializingQueries(topic string) []string {
+	return []string{strings.Join([]string{
+		`CREATE TABLE IF NOT EXISTS ` + s.MessagesTable(topic) + ` (`,
+		`"offset" SERIAL,`,
+		`"uuid" VARCHAR(36) NOT NULL,`,
+		`"created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,`,
+		`"payload" BYTEA DEFAULT NULL,`,
+		`"metadata" JSON DEFAULT NULL`,
+		`);`,
+	}, "\n")}
+}
+
+// closeAll closes everything, even when some of them fail, and returns all errors.
+func closeAll(closers []io.Closer) error {
+	var errs []string
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("cannot close transport: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}